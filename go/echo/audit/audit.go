@@ -0,0 +1,87 @@
+package audit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"shortr/model"
+	"time"
+)
+
+const (
+	SubjectURL     = "url"
+	SubjectWebhook = "webhook"
+)
+
+const (
+	ActionCreate     = "create"
+	ActionUpdate     = "update"
+	ActionRollback   = "rollback"
+	ActionRules      = "rules"
+	ActionPlatforms  = "platforms"
+	ActionVariants   = "variants"
+	ActionSchedule   = "schedule"
+	ActionUnschedule = "unschedule"
+	ActionDelete     = "delete"
+	ActionRestore    = "restore"
+	ActionPurge      = "purge"
+	ActionRetry      = "retry"
+)
+
+// Snapshot encodes the value as an entry snapshot, a nil value has no snapshot
+func Snapshot(value interface{}) json.RawMessage {
+	if value == nil {
+		return nil
+	}
+	snapshot, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	return snapshot
+}
+
+// Chain describes how audit entries are chained, keyed by a server secret so entries can not be rehashed without it
+type Chain struct {
+	key []byte
+}
+
+// New creates a new Chain instance keyed by the secret
+func New(key []byte) *Chain {
+	return &Chain{
+		key: key,
+	}
+}
+
+// Hash chains the entry to the hash of the previous entry, covering every field but the id
+func (c *Chain) Hash(previous string, entry model.AuditEntry) string {
+	// A JSON array keeps the boundaries between fields unambiguous
+	content, _ := json.Marshal([]interface{}{
+		previous,
+		entry.Subject,
+		entry.Action,
+		entry.URLID,
+		entry.Actor,
+		entry.IP,
+		entry.UserAgent,
+		entry.RequestID,
+		string(entry.Before),
+		string(entry.After),
+		entry.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write(content)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks that the entries, ordered by id, are chained after the previous hash.
+// It returns the hash of the last entry and the index of the first tampered entry, or -1 if there is none.
+func (c *Chain) Verify(previous string, entries []model.AuditEntry) (string, int) {
+	for i, entry := range entries {
+		if entry.PrevHash != previous || c.Hash(previous, entry) != entry.Hash {
+			return previous, i
+		}
+		previous = entry.Hash
+	}
+	return previous, -1
+}
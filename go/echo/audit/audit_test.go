@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"encoding/json"
+	"shortr/model"
+	"testing"
+	"time"
+)
+
+func TestHash(t *testing.T) {
+	chain := New([]byte("secret"))
+	urlID := 1
+	entry := model.AuditEntry{
+		Subject:   SubjectURL,
+		Action:    ActionUpdate,
+		URLID:     &urlID,
+		Actor:     "scheduler",
+		Before:    json.RawMessage(`{"url":"https://a.com"}`),
+		After:     json.RawMessage(`{"url":"https://b.com"}`),
+		CreatedAt: time.Date(2026, 10, 18, 9, 30, 0, 123456000, time.UTC),
+	}
+	hash := chain.Hash("", entry)
+
+	if len(hash) != 64 {
+		t.Errorf("Hash length = %d, want 64", len(hash))
+	}
+	if chain.Hash("", entry) != hash {
+		t.Error("Hash of the same entry differs")
+	}
+
+	modified := entry
+	modified.After = json.RawMessage(`{"url":"https://c.com"}`)
+	webhook := entry
+	webhook.Subject = SubjectWebhook
+	webhook.URLID = nil
+	unkeyed := New(nil)
+
+	tests := []struct {
+		name  string
+		chain *Chain
+		prev  string
+		entry model.AuditEntry
+	}{
+		{"previous hash", chain, "5f3c", entry},
+		{"field", chain, "", modified},
+		{"subject", chain, "", webhook},
+		{"key", unkeyed, "", entry},
+	}
+
+	for _, test := range tests {
+		if test.chain.Hash(test.prev, test.entry) == hash {
+			t.Errorf("Hash with another %s = %s, want it to differ", test.name, hash)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	chain := New([]byte("secret"))
+
+	entries := make([]model.AuditEntry, 3)
+	previous := ""
+	for i := range entries {
+		urlID := i + 1
+		entries[i] = model.AuditEntry{ID: int64(i + 1), Subject: SubjectURL, Action: ActionCreate, URLID: &urlID, PrevHash: previous}
+		entries[i].Hash = chain.Hash(previous, entries[i])
+		previous = entries[i].Hash
+	}
+
+	tampered := append([]model.AuditEntry{}, entries...)
+	tampered[1].Actor = "someone"
+
+	removed := []model.AuditEntry{entries[0], entries[2]}
+
+	tests := []struct {
+		name     string
+		chain    *Chain
+		entries  []model.AuditEntry
+		want     string
+		tampered int
+	}{
+		{"valid", chain, entries, entries[2].Hash, -1},
+		{"empty", chain, nil, "", -1},
+		{"modified", chain, tampered, entries[0].Hash, 1},
+		{"removed", chain, removed, entries[0].Hash, 1},
+		{"other key", New([]byte("other")), entries, "", 0},
+	}
+
+	for _, test := range tests {
+		last, index := test.chain.Verify("", test.entries)
+		if last != test.want || index != test.tampered {
+			t.Errorf("Verify of %s entries = %q, %d, want %q, %d", test.name, last, index, test.want, test.tampered)
+		}
+	}
+}
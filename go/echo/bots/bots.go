@@ -0,0 +1,111 @@
+package bots
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+//go:embed patterns.txt
+var defaultPatterns string
+
+var ErrEmptyPatterns = errors.New("bot patterns are empty")
+
+// Detector classifies visits as bots by their user agent and by request heuristics
+type Detector struct {
+	patterns        *regexp.Regexp
+	requireLanguage bool
+}
+
+// New creates a new Detector instance matching the user agent against the case insensitive patterns.
+// Requests without Accept-Language are only bots when requireLanguage is set, as privacy tools and webviews may strip it.
+// Empty patterns would match every user agent, so they are rejected.
+func New(patterns []string, requireLanguage bool) (*Detector, error) {
+	if len(patterns) == 0 {
+		return nil, ErrEmptyPatterns
+	}
+	for _, pattern := range patterns {
+		if pattern == "" {
+			return nil, ErrEmptyPatterns
+		}
+	}
+
+	regex, err := regexp.Compile("(?i)" + strings.Join(patterns, "|"))
+	if err != nil {
+		return nil, err
+	}
+	return &Detector{
+		patterns:        regex,
+		requireLanguage: requireLanguage,
+	}, nil
+}
+
+// Default creates a new Detector instance with the embedded patterns list
+func Default(requireLanguage bool) *Detector {
+	detector, err := New(parse(strings.NewReader(defaultPatterns)), requireLanguage)
+	if err != nil {
+		panic(err)
+	}
+	return detector
+}
+
+// Load creates a new Detector instance with the patterns list file, one pattern per line and # for comments
+func Load(path string, requireLanguage bool) (*Detector, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return New(parse(file), requireLanguage)
+}
+
+// IsBot reports whether the request is made by a bot rather than by a person
+func (d *Detector) IsBot(req *http.Request) bool {
+	ua := req.UserAgent()
+
+	switch {
+	case ua == "":
+		return true
+	case d.patterns.MatchString(ua):
+		return true
+	// Browsers prefetching links or rendering previews are not visits yet
+	case isPrefetch(req.Header):
+		return true
+	// Browsers always send this header, unlike clients posing as them
+	case req.Header.Get("Accept") == "":
+		return true
+	case d.requireLanguage && req.Header.Get("Accept-Language") == "":
+		return true
+	}
+
+	return false
+}
+
+func isPrefetch(header http.Header) bool {
+	for _, key := range []string{"Purpose", "Sec-Purpose", "X-Purpose", "X-Moz"} {
+		value := strings.ToLower(header.Get(key))
+		if strings.Contains(value, "prefetch") || strings.Contains(value, "preview") {
+			return true
+		}
+	}
+	return false
+}
+
+func parse(reader io.Reader) []string {
+	var patterns []string
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns
+}
@@ -0,0 +1,82 @@
+package bots
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const browser = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Safari/537.36"
+
+func TestIsBot(t *testing.T) {
+	tests := []struct {
+		name            string
+		headers         map[string]string
+		requireLanguage bool
+		want            bool
+	}{
+		{"browser", map[string]string{"User-Agent": browser, "Accept": "text/html", "Accept-Language": "en"}, false, false},
+		{"no user agent", map[string]string{"Accept": "text/html", "Accept-Language": "en"}, false, true},
+		{"crawler", map[string]string{"User-Agent": "Mozilla/5.0 (compatible; Googlebot/2.1)", "Accept": "*/*", "Accept-Language": "en"}, false, true},
+		{"unfurler", map[string]string{"User-Agent": "Slackbot-LinkExpanding 1.0", "Accept": "*/*", "Accept-Language": "en"}, false, true},
+		{"library", map[string]string{"User-Agent": "curl/8.4.0", "Accept": "*/*", "Accept-Language": "en"}, false, true},
+		{"prefetch", map[string]string{"User-Agent": browser, "Accept": "text/html", "Accept-Language": "en", "Sec-Purpose": "prefetch"}, false, true},
+		{"preview", map[string]string{"User-Agent": browser, "Accept": "text/html", "Accept-Language": "en", "X-Purpose": "preview"}, false, true},
+		{"no accept", map[string]string{"User-Agent": browser, "Accept-Language": "en"}, false, true},
+		{"no accept language", map[string]string{"User-Agent": browser, "Accept": "text/html"}, false, false},
+		{"no accept language required", map[string]string{"User-Agent": browser, "Accept": "text/html"}, true, true},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+		for key, value := range test.headers {
+			req.Header.Set(key, value)
+		}
+		if got := Default(test.requireLanguage).IsBot(req); got != test.want {
+			t.Errorf("IsBot of %s = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New([]string{"("}, false); err == nil {
+		t.Error("New with an invalid pattern did not fail")
+	}
+	for _, patterns := range [][]string{nil, {}, {"mybot", ""}} {
+		if _, err := New(patterns, false); err != ErrEmptyPatterns {
+			t.Errorf("New(%q) error = %v, want %v", patterns, err, ErrEmptyPatterns)
+		}
+	}
+
+	detector, err := New([]string{"mybot", "monitor/\\d+"}, false)
+	if err != nil {
+		t.Fatalf("New error = %v", err)
+	}
+
+	tests := []struct {
+		ua   string
+		want bool
+	}{
+		{"MyBot/1.0", true},
+		{"Monitor/2", true},
+		{"Monitor/beta", false},
+		{browser, false},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+		req.Header.Set("User-Agent", test.ua)
+		req.Header.Set("Accept", "*/*")
+		if got := detector.IsBot(req); got != test.want {
+			t.Errorf("IsBot(%q) = %v, want %v", test.ua, got, test.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	patterns := parse(strings.NewReader("# comment\n\nbot\n  crawler  \n#ignored\n"))
+	if len(patterns) != 2 || patterns[0] != "bot" || patterns[1] != "crawler" {
+		t.Errorf("parse = %q, want [bot crawler]", patterns)
+	}
+}
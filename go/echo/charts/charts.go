@@ -0,0 +1,180 @@
+package charts
+
+import (
+	"fmt"
+	"html/template"
+	"shortr/model"
+	"sort"
+	"strings"
+)
+
+const (
+	width      = 640
+	padding    = 40
+	color      = "#B721FF"
+	textColor  = "#4e4a67"
+	emptyColor = "#e8e8ee"
+)
+
+var weekdays = [7]string{"Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"}
+
+// Bar describes a labelled value of a bars chart
+type Bar struct {
+	Label string
+	Value int
+}
+
+// BarsOf gets the bars of the values, sorted by descending value and then by label
+func BarsOf(values map[string]int) []Bar {
+	bars := make([]Bar, 0, len(values))
+	for label, value := range values {
+		bars = append(bars, Bar{Label: label, Value: value})
+	}
+	sort.Slice(bars, func(i, j int) bool {
+		if bars[i].Value != bars[j].Value {
+			return bars[i].Value > bars[j].Value
+		}
+		return bars[i].Label < bars[j].Label
+	})
+	return bars
+}
+
+// Series renders the human hits of consecutive points as an inline SVG step area chart
+func Series(points []model.Point) template.HTML {
+	if len(points) == 0 {
+		return empty("No hits in this range")
+	}
+
+	const height, top, bottom = 180, 10, 150
+	max := 0
+	for _, point := range points {
+		if point.Hits > max {
+			max = point.Hits
+		}
+	}
+
+	var svg strings.Builder
+	open(&svg, height, "Hits over time")
+
+	step := float64(width-padding) / float64(len(points))
+	scale := 0.0
+	if max > 0 {
+		scale = float64(bottom-top) / float64(max)
+	}
+
+	// Each point is a step as wide as its interval, so single points and gaps remain visible
+	fmt.Fprintf(&svg, `<path fill="%s" fill-opacity="0.6" stroke="%s" d="M%d %d`, color, color, padding, bottom)
+	for i, point := range points {
+		y := float64(bottom) - float64(point.Hits)*scale
+		fmt.Fprintf(&svg, " L%.1f %.1f L%.1f %.1f", float64(padding)+float64(i)*step, y, float64(padding)+float64(i+1)*step, y)
+	}
+	fmt.Fprintf(&svg, ` L%d %d Z"/>`, width, bottom)
+
+	fmt.Fprintf(&svg, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="%s"/>`, padding, bottom, width, bottom, textColor)
+	fmt.Fprintf(&svg, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="%s" stroke-dasharray="4"/>`, padding, top, width, top, emptyColor)
+	label(&svg, padding-6, top+4, "end", fmt.Sprint(max))
+	label(&svg, padding-6, bottom+4, "end", "0")
+	label(&svg, padding, bottom+20, "start", points[0].Time.Format("02 Jan 2006"))
+	label(&svg, width, bottom+20, "end", points[len(points)-1].Time.Format("02 Jan 2006"))
+
+	svg.WriteString("</svg>")
+	return template.HTML(svg.String())
+}
+
+// Heatmap renders the hits of each hour of each day of the week, starting on Monday, as an inline SVG heatmap
+func Heatmap(hits [7][24]int) template.HTML {
+	const cell, top = 24, 20
+	const height = top + 7*cell
+
+	max := 0
+	for _, day := range hits {
+		for _, count := range day {
+			if count > max {
+				max = count
+			}
+		}
+	}
+	if max == 0 {
+		return empty("No hits in this range")
+	}
+
+	var svg strings.Builder
+	open(&svg, height, "Hits by hour of the week")
+
+	for hour := 0; hour < 24; hour += 6 {
+		label(&svg, padding+hour*cell, top-6, "start", fmt.Sprintf("%02d:00", hour))
+	}
+	for weekday, day := range hits {
+		label(&svg, padding-6, top+weekday*cell+cell/2+4, "end", weekdays[weekday])
+		for hour, count := range day {
+			// Empty hours are grey, the rest shade from light to the primary color
+			fill, opacity := emptyColor, 1.0
+			if count > 0 {
+				fill, opacity = color, 0.15+0.85*float64(count)/float64(max)
+			}
+			fmt.Fprintf(&svg, `<rect x="%d" y="%d" width="%d" height="%d" rx="3" fill="%s" fill-opacity="%.2f"><title>%s %02d:00, %d hits</title></rect>`,
+				padding+hour*cell+1, top+weekday*cell+1, cell-2, cell-2, fill, opacity, weekdays[weekday], hour, count)
+		}
+	}
+
+	svg.WriteString("</svg>")
+	return template.HTML(svg.String())
+}
+
+// Bars renders the bars, in order, as an inline SVG horizontal bars chart titled title
+func Bars(title string, bars []Bar) template.HTML {
+	if len(bars) == 0 {
+		return empty("No hits in this range")
+	}
+
+	const row, labelWidth, valueWidth = 24, 160, 60
+	height := len(bars) * row
+
+	max := 0
+	for _, bar := range bars {
+		if bar.Value > max {
+			max = bar.Value
+		}
+	}
+
+	var svg strings.Builder
+	open(&svg, height, title)
+
+	for i, bar := range bars {
+		y := i * row
+		length := 0.0
+		if max > 0 {
+			length = float64(width-labelWidth-valueWidth) * float64(bar.Value) / float64(max)
+		}
+		label(&svg, labelWidth-8, y+row/2+4, "end", truncate(bar.Label, 22))
+		fmt.Fprintf(&svg, `<rect x="%d" y="%d" width="%.1f" height="%d" rx="3" fill="%s"><title>%s, %d</title></rect>`,
+			labelWidth, y+3, length, row-6, color, template.HTMLEscapeString(bar.Label), bar.Value)
+		label(&svg, labelWidth+int(length)+6, y+row/2+4, "start", fmt.Sprint(bar.Value))
+	}
+
+	svg.WriteString("</svg>")
+	return template.HTML(svg.String())
+}
+
+func open(svg *strings.Builder, height int, title string) {
+	fmt.Fprintf(svg, `<svg class="chart" xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" role="img" aria-label="%s">`, width, height, template.HTMLEscapeString(title))
+}
+
+func label(svg *strings.Builder, x int, y int, anchor string, text string) {
+	fmt.Fprintf(svg, `<text x="%d" y="%d" text-anchor="%s" font-size="12" fill="%s">%s</text>`, x, y, anchor, textColor, template.HTMLEscapeString(text))
+}
+
+func empty(text string) template.HTML {
+	var svg strings.Builder
+	open(&svg, 40, text)
+	label(&svg, width/2, 24, "middle", text)
+	svg.WriteString("</svg>")
+	return template.HTML(svg.String())
+}
+
+func truncate(text string, length int) string {
+	if runes := []rune(text); len(runes) > length {
+		return string(runes[:length]) + "..."
+	}
+	return text
+}
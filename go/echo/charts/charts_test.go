@@ -0,0 +1,78 @@
+package charts
+
+import (
+	"html/template"
+	"reflect"
+	"shortr/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBarsOf(t *testing.T) {
+	tests := []struct {
+		values map[string]int
+		want   []Bar
+	}{
+		{map[string]int{}, []Bar{}},
+		{map[string]int{"b": 1, "a": 3, "c": 2}, []Bar{{"a", 3}, {"c", 2}, {"b", 1}}},
+		{map[string]int{"mobile": 2, "desktop": 2, "tablet": 5}, []Bar{{"tablet", 5}, {"desktop", 2}, {"mobile", 2}}},
+	}
+
+	for _, test := range tests {
+		if got := BarsOf(test.values); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("BarsOf(%v) = %v, want %v", test.values, got, test.want)
+		}
+	}
+}
+
+func TestCharts(t *testing.T) {
+	day := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	var hits [7][24]int
+	hits[0][9] = 4
+
+	tests := []struct {
+		name  string
+		chart template.HTML
+		want  []string
+	}{
+		{"empty series", Series(nil), []string{"No hits in this range"}},
+		{"series", Series([]model.Point{{Time: day, Hits: 3}, {Time: day.AddDate(0, 0, 1), Hits: 0}}),
+			[]string{`aria-label="Hits over time"`, "<path", ">3</text>", "18 Oct 2026", "19 Oct 2026"}},
+		{"empty heatmap", Heatmap([7][24]int{}), []string{"No hits in this range"}},
+		{"heatmap", Heatmap(hits), []string{`aria-label="Hits by hour of the week"`, "<title>Mon 09:00, 4 hits</title>", "<title>Sun 23:00, 0 hits</title>"}},
+		{"empty bars", Bars("Hits by variant", nil), []string{"No hits in this range"}},
+		{"bars", Bars("Top referrers", []Bar{{"<script>", 2}, {"a-very-long-referrer-domain.example.com", 1}}),
+			[]string{`aria-label="Top referrers"`, "&lt;script&gt;", "a-very-long-referrer-d...", ">2</text>"}},
+	}
+
+	for _, test := range tests {
+		svg := string(test.chart)
+		if !strings.HasPrefix(svg, "<svg") || !strings.HasSuffix(svg, "</svg>") {
+			t.Errorf("Chart of %s is not an SVG: %s", test.name, svg)
+		}
+		for _, want := range test.want {
+			if !strings.Contains(svg, want) {
+				t.Errorf("Chart of %s does not contain %q", test.name, want)
+			}
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		text   string
+		length int
+		want   string
+	}{
+		{"short", 10, "short"},
+		{"exactly", 7, "exactly"},
+		{"señor.example.com", 5, "señor..."},
+	}
+
+	for _, test := range tests {
+		if got := truncate(test.text, test.length); got != test.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", test.text, test.length, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package checker
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+const (
+	StatusOK          = "ok"
+	StatusBroken      = "broken"
+	StatusUnreachable = "unreachable"
+)
+
+// Result describes the outcome of probing a destination url
+type Result struct {
+	Status string
+	Code   *int
+}
+
+// Failed reports whether the destination url is not working
+func (r Result) Failed() bool {
+	return r.Status != StatusOK
+}
+
+// Checker probes destination urls in order to find dead links
+type Checker struct {
+	client      *http.Client
+	concurrency int
+}
+
+// New creates a new Checker instance
+func New(client *http.Client, concurrency int) *Checker {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &Checker{
+		client:      client,
+		concurrency: concurrency,
+	}
+}
+
+// Check probes the url and returns its Result
+func (c *Checker) Check(ctx context.Context, url string) Result {
+	res, err := c.request(ctx, http.MethodHead, url)
+	if err != nil {
+		return Result{Status: StatusUnreachable}
+	}
+
+	// Some servers do not implement HEAD requests properly
+	if res.StatusCode == http.StatusMethodNotAllowed || res.StatusCode == http.StatusNotImplemented {
+		res, err = c.request(ctx, http.MethodGet, url)
+		if err != nil {
+			return Result{Status: StatusUnreachable}
+		}
+	}
+
+	code := res.StatusCode
+	if code >= 400 {
+		return Result{Status: StatusBroken, Code: &code}
+	}
+	return Result{Status: StatusOK, Code: &code}
+}
+
+// CheckAll probes the urls, at most concurrency at a time, and returns their Results in the same order
+func (c *Checker) CheckAll(ctx context.Context, urls []string) []Result {
+	results := make([]Result, len(urls))
+	semaphore := make(chan struct{}, c.concurrency)
+	var wg sync.WaitGroup
+
+	for i, url := range urls {
+		semaphore <- struct{}{}
+		wg.Add(1)
+		go func(i int, url string) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			results[i] = c.Check(ctx, url)
+		}(i, url)
+	}
+
+	wg.Wait()
+	return results
+}
+
+func (c *Checker) request(ctx context.Context, method string, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Shortr-Checker/1.0")
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+
+	return res, nil
+}
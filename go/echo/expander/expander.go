@@ -0,0 +1,110 @@
+package expander
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	nurl "net/url"
+)
+
+var ErrTooManyRedirects = errors.New("destination url has too many redirects")
+var ErrLoop = errors.New("destination url redirects in a loop")
+
+// Expander follows the redirect chain of destination urls
+type Expander struct {
+	client       *http.Client
+	maxRedirects int
+	check        func(context.Context, string) error
+}
+
+// New creates a new Expander instance, which checks every url of the chain before requesting it.
+// The client redirect policy is overridden, as redirects are followed one by one.
+func New(client *http.Client, maxRedirects int, check func(context.Context, string) error) *Expander {
+	expanderClient := *client
+	expanderClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return &Expander{
+		client:       &expanderClient,
+		maxRedirects: maxRedirects,
+		check:        check,
+	}
+}
+
+// Expand follows the redirects of the url and returns the final url.
+// The first url of the chain rejected by the check stops the expansion with the rejection reason.
+func (e *Expander) Expand(ctx context.Context, url string) (string, error) {
+	visited := map[string]bool{url: true}
+
+	current := url
+	for redirects := 0; ; redirects++ {
+		if err := e.check(ctx, current); err != nil {
+			return "", err
+		}
+
+		next, err := e.next(ctx, current)
+		if err != nil {
+			return "", err
+		}
+
+		if next == nil {
+			return current, nil
+		}
+
+		if redirects >= e.maxRedirects {
+			return "", ErrTooManyRedirects
+		}
+
+		if visited[next.String()] {
+			return "", ErrLoop
+		}
+
+		current = next.String()
+		visited[current] = true
+	}
+}
+
+func (e *Expander) next(ctx context.Context, url string) (*nurl.URL, error) {
+	res, err := e.request(ctx, http.MethodHead, url)
+	if err != nil {
+		return nil, err
+	}
+
+	// Some servers do not implement HEAD requests properly
+	if res.StatusCode == http.StatusMethodNotAllowed || res.StatusCode == http.StatusNotImplemented {
+		res, err = e.request(ctx, http.MethodGet, url)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if res.StatusCode < 300 || res.StatusCode > 399 {
+		return nil, nil
+	}
+
+	location, err := res.Location()
+	if err != nil {
+		if err == http.ErrNoLocation {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return location, nil
+}
+
+func (e *Expander) request(ctx context.Context, method string, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+
+	return res, nil
+}
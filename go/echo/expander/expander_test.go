@@ -0,0 +1,116 @@
+package expander
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var errRejected = errors.New("rejected")
+
+func allowAll(ctx context.Context, url string) error {
+	return nil
+}
+
+func newServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/a", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/b", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/b", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/final", http.StatusFound)
+	})
+	mux.HandleFunc("/final", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop-back", http.StatusFound)
+	})
+	mux.HandleFunc("/loop-back", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/no-head", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		http.Redirect(w, r, "/final", http.StatusFound)
+	})
+	mux.HandleFunc("/no-location", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusFound)
+	})
+	mux.HandleFunc("/private", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/internal", http.StatusFound)
+	})
+	mux.HandleFunc("/internal", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("requested a url rejected by the check")
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestExpand(t *testing.T) {
+	server := newServer(t)
+
+	tests := []struct {
+		path         string
+		maxRedirects int
+		want         string
+		err          error
+	}{
+		{"/final", 10, "/final", nil},
+		{"/a", 10, "/final", nil},
+		{"/a", 2, "/final", nil},
+		{"/a", 1, "", ErrTooManyRedirects},
+		{"/loop", 10, "", ErrLoop},
+		{"/no-head", 10, "/final", nil},
+		{"/no-location", 10, "/no-location", nil},
+	}
+
+	for _, test := range tests {
+		expander := New(server.Client(), test.maxRedirects, allowAll)
+		got, err := expander.Expand(context.Background(), server.URL+test.path)
+		if err != test.err {
+			t.Errorf("Expand(%q) error = %v, want %v", test.path, err, test.err)
+			continue
+		}
+		if test.err == nil && got != server.URL+test.want {
+			t.Errorf("Expand(%q) = %q, want %q", test.path, got, server.URL+test.want)
+		}
+	}
+}
+
+func TestExpandChecksEveryHop(t *testing.T) {
+	server := newServer(t)
+
+	var checked []string
+	expander := New(server.Client(), 10, func(ctx context.Context, url string) error {
+		checked = append(checked, strings.TrimPrefix(url, server.URL))
+		if strings.HasSuffix(url, "/internal") {
+			return errRejected
+		}
+		return nil
+	})
+
+	if _, err := expander.Expand(context.Background(), server.URL+"/private"); err != errRejected {
+		t.Fatalf("Expand error = %v, want %v", err, errRejected)
+	}
+	if strings.Join(checked, ",") != "/private,/internal" {
+		t.Errorf("checked %v, want [/private /internal]", checked)
+	}
+}
+
+func TestExpandUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	expander := New(http.DefaultClient, 10, allowAll)
+	if _, err := expander.Expand(context.Background(), url); err == nil {
+		t.Error("Expand of a closed server succeeded")
+	}
+}
@@ -0,0 +1,133 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"shortr/model"
+	"strconv"
+	"time"
+)
+
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+var ErrInvalidFormat = errors.New("invalid export format")
+
+// Row describes an exported row, encoded as a JSON object or as a CSV record
+type Row interface {
+	Record() []string
+}
+
+// Click describes an exported click of an URL
+type Click struct {
+	Name string `json:"name"`
+	model.Click
+}
+
+// ClickHeader are the CSV columns of a Click
+var ClickHeader = []string{"name", "id", "url_id", "clicked_at", "os", "device", "variant", "bot", "referrer", "source", "country", "region", "browser"}
+
+// Record satisfies the Row interface
+func (c Click) Record() []string {
+	return []string{
+		c.Name,
+		strconv.FormatInt(c.ID, 10),
+		strconv.Itoa(c.URLID),
+		c.ClickedAt.UTC().Format(time.RFC3339Nano),
+		c.OS,
+		c.Device,
+		optional(c.Variant),
+		strconv.FormatBool(c.Bot),
+		optional(c.Referrer),
+		c.Source,
+		optional(c.Country),
+		optional(c.Region),
+		c.Browser,
+	}
+}
+
+// Point describes an exported point of the hits series of an URL
+type Point struct {
+	model.Point
+}
+
+// PointHeader are the CSV columns of a Point
+var PointHeader = []string{"name", "time", "hits", "bot_hits"}
+
+// Record satisfies the Row interface
+func (p Point) Record() []string {
+	return []string{
+		p.Name,
+		p.Time.UTC().Format(time.RFC3339),
+		strconv.Itoa(p.Hits),
+		strconv.Itoa(p.BotHits),
+	}
+}
+
+// Encoder writes rows in an export format
+type Encoder interface {
+	Encode(row Row) error
+	Flush() error
+}
+
+// New creates a new Encoder instance for the format, CSV encoders write the header first
+func New(w io.Writer, format string, header []string) (Encoder, error) {
+	switch format {
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(header); err != nil {
+			return nil, err
+		}
+		return &csvEncoder{writer: writer}, nil
+	case FormatNDJSON:
+		return &ndjsonEncoder{encoder: json.NewEncoder(w)}, nil
+	default:
+		return nil, ErrInvalidFormat
+	}
+}
+
+// ContentType gets the media type of the format
+func ContentType(format string) string {
+	if format == FormatNDJSON {
+		return "application/x-ndjson"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// optional gets the value, or an empty string if there is none
+func optional(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+type csvEncoder struct {
+	writer *csv.Writer
+}
+
+func (e *csvEncoder) Encode(row Row) error {
+	return e.writer.Write(row.Record())
+}
+
+func (e *csvEncoder) Flush() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+type ndjsonEncoder struct {
+	encoder *json.Encoder
+}
+
+func (e *ndjsonEncoder) Encode(row Row) error {
+	// The encoder ends every value with a new line
+	return e.encoder.Encode(row)
+}
+
+func (e *ndjsonEncoder) Flush() error {
+	return nil
+}
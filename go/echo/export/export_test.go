@@ -0,0 +1,80 @@
+package export
+
+import (
+	"bytes"
+	"shortr/model"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	variant, referrer := "b", "t.co"
+	click := Click{
+		Name: "promo",
+		Click: model.Click{
+			ID:        1,
+			URLID:     2,
+			ClickedAt: time.Date(2026, 10, 18, 9, 30, 0, 123456000, time.UTC),
+			OS:        "ios",
+			Device:    "mobile",
+			Variant:   &variant,
+			Referrer:  &referrer,
+			Source:    "social",
+			Browser:   "safari",
+		},
+	}
+	point := Point{Point: model.Point{Name: "promo", Time: time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC), Hits: 3, BotHits: 1}}
+
+	tests := []struct {
+		format string
+		header []string
+		row    Row
+		want   string
+		err    error
+	}{
+		{FormatCSV, ClickHeader, click, "name,id,url_id,clicked_at,os,device,variant,bot,referrer,source,country,region,browser\n" +
+			"promo,1,2,2026-10-18T09:30:00.123456Z,ios,mobile,b,false,t.co,social,,,safari\n", nil},
+		{FormatCSV, PointHeader, point, "name,time,hits,bot_hits\npromo,2026-10-18T00:00:00Z,3,1\n", nil},
+		{FormatNDJSON, ClickHeader, click, `{"name":"promo","id":1,"url_id":2,"clicked_at":"2026-10-18T09:30:00.123456Z","os":"ios",` +
+			`"device":"mobile","variant":"b","bot":false,"referrer":"t.co","source":"social","country":null,"region":null,"browser":"safari"}` + "\n", nil},
+		{FormatNDJSON, PointHeader, point, `{"name":"promo","time":"2026-10-18T00:00:00Z","hits":3,"bot_hits":1}` + "\n", nil},
+		{"xml", ClickHeader, click, "", ErrInvalidFormat},
+	}
+
+	for _, test := range tests {
+		var buffer bytes.Buffer
+		encoder, err := New(&buffer, test.format, test.header)
+		if err != test.err {
+			t.Errorf("New(%q) error = %v, want %v", test.format, err, test.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if err := encoder.Encode(test.row); err != nil {
+			t.Errorf("Encode as %q error = %v", test.format, err)
+		}
+		if err := encoder.Flush(); err != nil {
+			t.Errorf("Flush as %q error = %v", test.format, err)
+		}
+		if buffer.String() != test.want {
+			t.Errorf("Encode as %q = %q, want %q", test.format, buffer.String(), test.want)
+		}
+	}
+}
+
+func TestContentType(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{FormatCSV, "text/csv; charset=utf-8"},
+		{FormatNDJSON, "application/x-ndjson"},
+	}
+
+	for _, test := range tests {
+		if got := ContentType(test.format); got != test.want {
+			t.Errorf("ContentType(%q) = %q, want %q", test.format, got, test.want)
+		}
+	}
+}
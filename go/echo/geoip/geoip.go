@@ -0,0 +1,118 @@
+package geoip
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"subdivisions"`
+}
+
+// Location describes where an ip is
+type Location struct {
+	Country string // ISO 3166-1 alpha-2 code
+	Region  string // ISO 3166-2 code, like US-CA, only known with city databases
+}
+
+// Locator resolves IP addresses against a local MaxMind format database
+type Locator struct {
+	path    string
+	reader  *maxminddb.Reader
+	modTime time.Time
+	size    int64
+	mutex   sync.RWMutex
+}
+
+// Open creates a new Locator instance from the database file
+func Open(path string) (*Locator, error) {
+	locator := &Locator{
+		path: path,
+	}
+	if _, err := locator.Reload(); err != nil {
+		return nil, err
+	}
+	return locator, nil
+}
+
+// Reload reopens the database file if it changed since it was opened, and reports whether it did.
+// Lookups keep using the previous database until the new one is open, so a failed reload changes nothing.
+func (l *Locator) Reload() (bool, error) {
+	info, err := os.Stat(l.path)
+	if err != nil {
+		return false, err
+	}
+
+	l.mutex.RLock()
+	unchanged := l.reader != nil && info.ModTime().Equal(l.modTime) && info.Size() == l.size
+	l.mutex.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	reader, err := maxminddb.Open(l.path)
+	if err != nil {
+		return false, err
+	}
+
+	l.mutex.Lock()
+	previous := l.reader
+	l.reader, l.modTime, l.size = reader, info.ModTime(), info.Size()
+	l.mutex.Unlock()
+
+	// Lookups hold the read lock, so none is using the previous database anymore
+	if previous != nil {
+		return true, previous.Close()
+	}
+	return true, nil
+}
+
+// Close closes the database file
+func (l *Locator) Close() error {
+	if l == nil {
+		return nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.reader.Close()
+}
+
+// Locate gets the Location of the ip, with empty codes when they are unknown.
+// A nil Locator knows no locations, so callers do not need to check whether a database is configured.
+func (l *Locator) Locate(ip string) Location {
+	var location Location
+	if l == nil {
+		return location
+	}
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return location
+	}
+
+	var found record
+	l.mutex.RLock()
+	err := l.reader.Lookup(parsed, &found)
+	l.mutex.RUnlock()
+	if err != nil {
+		return location
+	}
+
+	location.Country = found.Country.ISOCode
+	if location.Country != "" && len(found.Subdivisions) > 0 && found.Subdivisions[0].ISOCode != "" {
+		location.Region = location.Country + "-" + found.Subdivisions[0].ISOCode
+	}
+
+	return location
+}
@@ -0,0 +1,73 @@
+package hll
+
+import (
+	"math"
+	"math/bits"
+)
+
+// Precision is the number of hash bits choosing the register, with a standard error of 1.04/sqrt(2^Precision)
+const Precision = 12
+
+// Registers is the number of registers of a Sketch, one byte each
+const Registers = 1 << Precision
+
+// Sketch is a HyperLogLog sketch estimating the number of distinct hashes added to it
+type Sketch []byte
+
+// New creates a new empty Sketch
+func New() Sketch {
+	return make(Sketch, Registers)
+}
+
+// Position gets the register of the hash and the rank it sets, that is the position of its first set bit after the register bits.
+// Sketches are updated by keeping the highest rank of each register, so they can be stored as registers and updated in place.
+func Position(hash uint64) (int, uint8) {
+	index := int(hash >> (64 - Precision))
+	// The sentinel bit bounds the rank when the remaining bits are zero
+	remaining := hash<<Precision | 1<<(Precision-1)
+	return index, uint8(bits.LeadingZeros64(remaining) + 1)
+}
+
+// Add adds the hash to the Sketch
+func (s Sketch) Add(hash uint64) {
+	index, rank := Position(hash)
+	if rank > s[index] {
+		s[index] = rank
+	}
+}
+
+// Merge adds the hashes of the other Sketch to the Sketch, ignoring sketches of another size
+func (s Sketch) Merge(other Sketch) {
+	if len(other) != len(s) {
+		return
+	}
+	for i, rank := range other {
+		if rank > s[i] {
+			s[i] = rank
+		}
+	}
+}
+
+// Count estimates the number of distinct hashes added to the Sketch
+func (s Sketch) Count() uint64 {
+	m := float64(len(s))
+	alpha := 0.7213 / (1 + 1.079/m)
+
+	sum := 0.0
+	zeros := 0
+	for _, rank := range s {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+
+	estimate := alpha * m * m / sum
+
+	// Linear counting is more accurate for small cardinalities, and 64 bit hashes need no large range correction
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+
+	return uint64(math.Round(estimate))
+}
@@ -0,0 +1,80 @@
+package hll
+
+import (
+	"math"
+	"testing"
+)
+
+// hash spreads the value over the 64 bits, as the fingerprints of visitors do
+func hash(value uint64) uint64 {
+	value += 0x9e3779b97f4a7c15
+	value = (value ^ value>>30) * 0xbf58476d1ce4e5b9
+	value = (value ^ value>>27) * 0x94d049bb133111eb
+	return value ^ value>>31
+}
+
+func TestPosition(t *testing.T) {
+	tests := []struct {
+		hash  uint64
+		index int
+		rank  uint8
+	}{
+		{0, 0, 53},
+		{1 << 51, 0, 1},
+		{1 << 50, 0, 2},
+		{1 << 63, 2048, 53},
+		{math.MaxUint64, Registers - 1, 1},
+		{0xfff0_0000_0000_0001, Registers - 1, 52},
+	}
+
+	for _, test := range tests {
+		index, rank := Position(test.hash)
+		if index != test.index || rank != test.rank {
+			t.Errorf("Position(%#x) = %d, %d, want %d, %d", test.hash, index, rank, test.index, test.rank)
+		}
+	}
+}
+
+func TestCount(t *testing.T) {
+	tests := []int{0, 1, 10, 1000, 10000, 100000}
+
+	for _, distinct := range tests {
+		sketch := New()
+		for i := 0; i < distinct; i++ {
+			sketch.Add(hash(uint64(i)))
+			// Repeated hashes are not counted again
+			sketch.Add(hash(uint64(i)))
+		}
+
+		// Four standard errors of 1.6% make the estimate deterministic enough to test
+		count := sketch.Count()
+		if math.Abs(float64(count)-float64(distinct)) > 0.065*float64(distinct)+0.5 {
+			t.Errorf("Count of %d distinct hashes = %d", distinct, count)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	a, b, both := New(), New(), New()
+	for i := 0; i < 20000; i++ {
+		if i < 15000 {
+			a.Add(hash(uint64(i)))
+		}
+		if i >= 5000 {
+			b.Add(hash(uint64(i)))
+		}
+		both.Add(hash(uint64(i)))
+	}
+
+	a.Merge(b)
+	if a.Count() != both.Count() {
+		t.Errorf("Count of merged sketches = %d, want %d", a.Count(), both.Count())
+	}
+
+	// Sketches of another precision are ignored
+	before := a.Count()
+	a.Merge(make(Sketch, Registers/2))
+	if a.Count() != before {
+		t.Errorf("Count after merging a sketch of another size = %d, want %d", a.Count(), before)
+	}
+}
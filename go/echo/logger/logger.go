@@ -284,8 +284,8 @@ func Database(logger *Logger) *Logger {
 	}
 }
 
-// Middleware implements echo.MiddlewareFunc interface
-func Middleware(logger *Logger) echo.MiddlewareFunc {
+// Middleware implements echo.MiddlewareFunc interface, logging the client ip as returned by ip
+func Middleware(logger *Logger, ip func(echo.Context) string) echo.MiddlewareFunc {
 	l := logger.Logger()
 	skipper := middleware.DefaultSkipper
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
@@ -309,7 +309,7 @@ func Middleware(logger *Logger) echo.MiddlewareFunc {
 				Str("method", req.Method).
 				Str("path", req.RequestURI).
 				Int("status", res.Status).
-				Str("ip_address", ctx.RealIP()).
+				Str("ip_address", ip(ctx)).
 				Str("user_agent", req.UserAgent()).
 				Dur("latency", stop.Sub(start)).
 				Msg("")
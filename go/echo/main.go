@@ -2,18 +2,50 @@ package main
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	nurl "net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"shortr/audit"
+	"shortr/bots"
 	"shortr/cache"
+	"shortr/checker"
 	"shortr/config"
+	"shortr/expander"
+	"shortr/export"
+	"shortr/geoip"
+	"shortr/hll"
 	"shortr/logger"
+	"shortr/metadata"
 	"shortr/model"
+	"shortr/normalizer"
+	"shortr/passthrough"
+	"shortr/policy"
+	"shortr/qr"
+	"shortr/ratelimit"
+	"shortr/referrer"
 	"shortr/render"
 	"shortr/repo"
+	"shortr/routing"
 	"shortr/shortid"
+	"shortr/useragent"
+	"shortr/webhook"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -22,60 +54,221 @@ import (
 
 var urlCache = cache.New(4096)
 var urlRepo *repo.Repo
+var urlPolicy *policy.Policy
+var urlExpander *expander.Expander
+var urlChecker *checker.Checker
+var urlFetcher *metadata.Fetcher
+var urlLocator *geoip.Locator
+var urlDetector *bots.Detector
+var urlSender *webhook.Sender
+var webhookPolicy *policy.Policy
+var hitMilestones = map[int]bool{}
+var hitQueue chan hit
+var droppedHits atomic.Int64 // Hits dropped while the queue was full, since they were last logged
+var visitorsSalt = []byte(config.GetEnvAsString("VISITORS_SALT", ""))
+var adminToken = []byte(config.GetEnvAsString("ADMIN_TOKEN", ""))
+var auditSecret = []byte(config.GetEnvAsString("AUDIT_SECRET", ""))
+var auditChain *audit.Chain
+var expandByDefault = config.GetEnvAsBool("EXPANDER_ENABLED", false)
+var dedupByDefault = config.GetEnvAsBool("DEDUP_ENABLED", false)
+var metadataByDefault = config.GetEnvAsBool("METADATA_ENABLED", false)
+var maxRules = config.GetEnvAsInt("RULES_MAX", 50)
+var maxVariants = config.GetEnvAsInt("VARIANTS_MAX", 20)
+var stickyVariantsMaxAge = config.GetEnvAsInt("VARIANTS_STICKY_MAX_AGE", 2592000)
+var rateLimitEnabled = config.GetEnvAsBool("RATELIMIT_ENABLED", true)
+var rateLimitAPIKeys = map[string]bool{} // Hashes of the API keys limited apart from the IP of their clients
+var trashGracePeriod = time.Duration(config.GetEnvAsInt("TRASH_GRACE_PERIOD", 2592000)) * time.Second
+var exportMaxNames = config.GetEnvAsInt("EXPORT_MAX_NAMES", 100)
+var exportBatchSize = config.GetEnvAsInt("EXPORT_BATCH_SIZE", 1000)
+var exportTimeout = time.Duration(config.GetEnvAsInt("EXPORT_TIMEOUT", 300)) * time.Second
+var exportSlots chan struct{} // Each running export holds a slot, as it holds a database connection until it ends
+
+// Names of the top level routes, urls named after them would never be reachable
+var reservedNames = map[string]bool{
+	"health":   true,
+	"urls":     true,
+	"audit":    true,
+	"export":   true,
+	"webhooks": true,
+	"styles":   true,
+	"scripts":  true,
+	"images":   true,
+}
+
+// Directories of the static assets, served before the urls
+var staticDirs = []string{"styles", "scripts", "images"}
+
+const schedulerActor = "scheduler" // Actor of the changes made by scheduled destinations
+const purgerActor = "purger"       // Actor of the permanent deletions of the trash
+const auditVerifyBatchSize = 1000  // Audit entries verified per query
+const statsChanges = 10            // Latest changes shown in the stats
+const webhookSecretBytes = 32      // Random bytes of the generated webhook secrets
+const statsTop = 10                // Top referrers, countries and regions shown in the stats by default
 
 func getURL(ctx echo.Context) error {
 	name := ctx.Param("name")
 
+	if queryBool(ctx, "preview", false) {
+		return previewURL(ctx)
+	}
+
 	if url, exists := urlCache.Read(name); exists {
-		go logIfErr(ctx.Logger(), wrap(urlRepo.UpdateMetricsByName(ctx.Request().Context(), name))...)
-		return ctx.Redirect(http.StatusTemporaryRedirect, url.(string)) // HTTP CODE 307 IN ORDER NOT TO GET URLs CACHED
+		return redirect(ctx, url.(model.URL))
 	}
 
 	url, err := urlRepo.GetByName(ctx.Request().Context(), name)
 	if err != nil {
 		if err == repo.ErrNoRows {
-			return echo.ErrNotFound
+			return notFoundOrGone(ctx, name)
+		}
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
+	}
+
+	go urlCache.Write(url.Name, url)
+
+	return redirect(ctx, url)
+}
+
+func previewURL(ctx echo.Context) error {
+	name := ctx.Param("name")
+	contentType := ctx.Request().Header.Get(echo.HeaderContentType)
+
+	url, err := urlRepo.GetByName(ctx.Request().Context(), name)
+	if err != nil {
+		if err == repo.ErrNoRows {
+			return notFoundOrGone(ctx, name)
 		}
 		ctx.Logger().Error(err)
 		return echo.ErrInternalServerError
 	}
 
-	go urlCache.Write(url.Name, url.URL)
-	go logIfErr(ctx.Logger(), wrap(urlRepo.UpdateMetricsByName(ctx.Request().Context(), name))...)
+	// The preview param is not part of the visit, so it is neither passed through nor kept to continue
+	query := nurl.Values{}
+	for key, values := range ctx.QueryParams() {
+		if key != "preview" {
+			query[key] = values
+		}
+	}
+
+	// The target is resolved as the redirect would, so the preview shows where the visitor is going
+	agent := useragent.Parse(ctx.Request().UserAgent())
+	location := urlLocator.Locate(ctx.RealIP())
+	target, _, err := resolve(ctx, url, agent, location, query)
+	if err != nil {
+		return err
+	}
+
+	preview := model.Preview{URL: url, Target: target, Path: ctx.Request().URL.EscapedPath(), Query: query, Safe: true}
+	if purl, err := nurl.Parse(target); err == nil {
+		preview.Domain = purl.Hostname()
+	}
 
-	return ctx.Redirect(http.StatusTemporaryRedirect, url.URL) // HTTP CODE 307 IN ORDER NOT TO GET URLs CACHED
+	// The policy may have changed since the url was created
+	if err := urlPolicy.Check(ctx.Request().Context(), target); err != nil {
+		reason := err.Error()
+		preview.Safe = false
+		preview.Reason = &reason
+	} else if url.CheckStatus != nil && *url.CheckStatus != checker.StatusOK {
+		reason := fmt.Sprintf("destination url is %s", *url.CheckStatus)
+		preview.Safe = false
+		preview.Reason = &reason
+	}
+
+	switch contentType {
+	case echo.MIMEApplicationJSON, echo.MIMEApplicationJSONCharsetUTF8:
+		return ctx.JSON(http.StatusOK, preview)
+	default:
+		return ctx.Render(http.StatusOK, "preview.gts.html", preview)
+	}
 }
 
 func shortenURL(ctx echo.Context) error {
 	name := ctx.Param("name")
 	qurl := ctx.QueryParam("url")
 
-	_, err := nurl.ParseRequestURI(qurl)
+	if reservedNames[name] {
+		return echo.NewHTTPError(http.StatusBadRequest, "reserved name")
+	}
+
+	err := urlPolicy.Check(ctx.Request().Context(), qurl)
 	if err != nil {
-		ctx.Logger().Error(err)
-		return echo.ErrBadRequest
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	queryMode, prefix, err := parseOptions(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	urlHash, err := normalizer.Hash(qurl)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	// Options which are not requested take their default values
+	mode, isPrefix := passthrough.ModeDrop, false
+	if queryMode != nil {
+		mode = *queryMode
+	}
+	if prefix != nil {
+		isPrefix = *prefix
+	}
+
+	// Custom names are never deduplicated
+	var key *string
+	if name == "" && queryBool(ctx, "dedup", dedupByDefault) {
+		dedup := dedupKey(urlHash, mode, isPrefix, queryBool(ctx, "expand", expandByDefault))
+		key = &dedup
+		duplicate, err := urlRepo.GetByDedupKey(ctx.Request().Context(), dedup)
+		if err == nil {
+			return ctx.JSON(http.StatusOK, duplicate)
+		}
+		if err != repo.ErrNoRows {
+			ctx.Logger().Error(err)
+			return echo.ErrInternalServerError
+		}
+	}
+
+	expandedURL, err := expandURL(ctx, qurl)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
 	var url model.URL
+	duplicate := false
 	err = urlRepo.Transaction(ctx.Request().Context(), func(urlTxRepo *repo.Repo) error {
-		url, err = urlTxRepo.Create(ctx.Request().Context(), qurl)
+		url, err = urlTxRepo.Create(ctx.Request().Context(), qurl, expandedURL, mode, isPrefix, key)
+		if err == repo.ErrNoRows && key != nil {
+			// The same url was created meanwhile by another request
+			duplicate = true
+			url, err = urlTxRepo.GetByDedupKey(ctx.Request().Context(), *key)
+			return err
+		}
 		if err != nil {
 			return err
 		}
 
-		if name == "" {
-			name, err = shortid.Encode(url.ID)
+		// The transaction may be retried, so the generated name is not kept
+		urlName := name
+		if urlName == "" {
+			urlName, err = shortid.Encode(url.ID)
 		}
 		if err != nil {
 			return err
 		}
 
-		url, err = urlTxRepo.UpdateNameByID(ctx.Request().Context(), url.ID, name)
+		url, err = urlTxRepo.UpdateNameByID(ctx.Request().Context(), url.ID, urlName)
 		if err != nil {
 			return err
 		}
 
-		return nil
+		err = recordChange(ctx.Request().Context(), urlTxRepo, nil, url, actorOf(ctx))
+		if err != nil {
+			return err
+		}
+
+		return auditURL(ctx, urlTxRepo, audit.ActionCreate, url.ID, nil, url)
 	})
 
 	if err != nil {
@@ -86,13 +279,34 @@ func shortenURL(ctx echo.Context) error {
 		return echo.ErrInternalServerError
 	}
 
+	if duplicate {
+		return ctx.JSON(http.StatusOK, url)
+	}
+
+	url = fetchMetadata(ctx, url)
+
 	return ctx.JSON(http.StatusOK, url)
 }
 
 func deleteURL(ctx echo.Context) error {
 	name := ctx.Param("name")
 
-	url, err := urlRepo.DeleteByName(ctx.Request().Context(), name)
+	var url, previous model.URL
+	err := urlRepo.Transaction(ctx.Request().Context(), func(urlTxRepo *repo.Repo) error {
+		var err error
+		previous, err = urlTxRepo.GetByName(ctx.Request().Context(), name)
+		if err != nil {
+			return err
+		}
+
+		url, err = urlTxRepo.DeleteByID(ctx.Request().Context(), previous.ID)
+		if err != nil {
+			return err
+		}
+
+		return auditURL(ctx, urlTxRepo, audit.ActionDelete, url.ID, previous, url)
+	})
+
 	if err != nil {
 		if err == repo.ErrNoRows {
 			return echo.ErrBadRequest
@@ -110,151 +324,2123 @@ func modifyURL(ctx echo.Context) error {
 	name := ctx.Param("name")
 	qurl := ctx.QueryParam("url")
 
-	_, err := nurl.ParseRequestURI(qurl)
+	queryMode, prefix, err := parseOptions(ctx)
 	if err != nil {
-		ctx.Logger().Error(err)
-		return echo.ErrBadRequest
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	url, err := urlRepo.UpdateURLByName(ctx.Request().Context(), name, qurl)
+	url, err := updateURL(ctx, audit.ActionUpdate, name, qurl, queryMode, prefix)
 	if err != nil {
-		if err == repo.ErrNoRows || err == repo.ErrIntegrityViolation {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, url)
+}
+
+func restoreURL(ctx echo.Context) error {
+	name := ctx.Param("name")
+
+	var url, previous model.URL
+	err := urlRepo.Transaction(ctx.Request().Context(), func(urlTxRepo *repo.Repo) error {
+		var err error
+		previous, err = urlTxRepo.GetDeletedByName(ctx.Request().Context(), name)
+		if err != nil {
+			return err
+		}
+
+		url, err = urlTxRepo.RestoreByName(ctx.Request().Context(), name, time.Now().Add(-trashGracePeriod))
+		if err != nil {
+			return err
+		}
+
+		return auditURL(ctx, urlTxRepo, audit.ActionRestore, url.ID, previous, url)
+	})
+
+	if err != nil {
+		if err == repo.ErrNoRows {
 			return echo.ErrBadRequest
 		}
 		ctx.Logger().Error(err)
 		return echo.ErrInternalServerError
 	}
 
-	if _, exists := urlCache.Read(url.Name); exists {
-		urlCache.Write(url.Name, url.URL)
-	}
-
 	return ctx.JSON(http.StatusOK, url)
 }
 
-func getURLStats(ctx echo.Context) error {
+func getURLHistory(ctx echo.Context) error {
 	name := ctx.Param("name")
-	contentType := ctx.Request().Header.Get(echo.HeaderContentType)
 
 	url, err := urlRepo.GetByName(ctx.Request().Context(), name)
 	if err != nil {
 		if err == repo.ErrNoRows {
-			return echo.ErrNotFound
+			return notFoundOrGone(ctx, name)
 		}
 		ctx.Logger().Error(err)
 		return echo.ErrInternalServerError
 	}
 
-	switch contentType {
-	case echo.MIMEApplicationJSON, echo.MIMEApplicationJSONCharsetUTF8:
-		return ctx.JSON(http.StatusOK, url)
-	default:
-		return ctx.Render(http.StatusOK, "stats.gts.html", url)
+	limit, offset := paginate(ctx)
+
+	changes, err := urlRepo.GetChangesByURLID(ctx.Request().Context(), url.ID, limit, offset)
+	if err != nil {
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
 	}
+
+	return ctx.JSON(http.StatusOK, changes)
 }
 
-func main() {
-	var err error
-	appLogger := logger.New("shortr")
+func rollbackURL(ctx echo.Context) error {
+	name := ctx.Param("name")
 
-	urlRepo, err = repo.Connect(fmt.Sprintf("postgresql://%s:%s@%s:%d/%s?sslmode=%s",
-		config.GetEnvAsString("DATABASE_USER", "postgres"),
-		config.GetEnvAsString("DATABASE_PASSWORD", "postgres"),
-		config.GetEnvAsString("DATABASE_HOST", "postgres"),
-		config.GetEnvAsInt("DATABASE_PORT", 5432),
-		config.GetEnvAsString("DATABASE_NAME", "postgres"),
-		config.GetEnvAsString("DATABASE_SSLMODE", "disable"),
-	), 5, logger.Database(appLogger))
+	id, err := strconv.Atoi(ctx.Param("id"))
 	if err != nil {
-		panic(err)
+		return echo.ErrBadRequest
 	}
-	defer urlRepo.Disconnect()
 
-	scheme := "http"
-	if config.GetEnvAsBool("APP_SSL_ENABLED", false) {
-		scheme = "https"
+	url, err := urlRepo.GetByName(ctx.Request().Context(), name)
+	if err != nil {
+		if err == repo.ErrNoRows {
+			return echo.ErrBadRequest
+		}
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
 	}
 
-	app := echo.New()
-	app.Logger = logger.Standard(appLogger)
-	app.HTTPErrorHandler = customHTTPErrorHandler
-	app.Renderer = render.New("/static/templates/*.gts.html")
-	app.IPExtractor = echo.ExtractIPFromRealIPHeader()
-
-	app.Pre(middleware.RemoveTrailingSlash())
-	app.Use(logger.Middleware(appLogger))
-	app.Use(middleware.Recover())
-	app.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{fmt.Sprintf("%s://%s",
-			scheme,
-			config.GetEnvAsSlice("VIRTUAL_HOST", []string{"localhost"})[0]),
-		}, // Add more origins if required
-		AllowMethods: []string{http.MethodGet, http.MethodPost, http.MethodDelete, http.MethodPut},
-	}))
+	change, err := urlRepo.GetChangeByID(ctx.Request().Context(), url.ID, id)
+	if err != nil {
+		if err == repo.ErrNoRows {
+			return echo.ErrBadRequest
+		}
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
+	}
 
-	// Routes
-	app.Static("/", "/static")
-	app.GET("/health", healthCheck)
-	app.POST("/", shortenURL)
-	url := app.Group("/:name")
-	/*--*/ url.GET("", getURL)
-	/*--*/ url.POST("", shortenURL)
-	/*--*/ url.DELETE("", deleteURL)
-	/*--*/ url.PUT("", modifyURL)
-	/*--*/ url.GET("/stats", getURLStats)
+	// The version is restored as a new change, so rollbacks can be rolled back too
+	url, err = updateURL(ctx, audit.ActionRollback, name, change.NewURL, nil, nil)
+	if err != nil {
+		return err
+	}
 
-	go app.Logger.Fatal(app.Start(fmt.Sprintf(":%d", config.GetEnvAsInt("APP_PORT", 80))))
+	return ctx.JSON(http.StatusOK, url)
+}
 
-	// Graceful shutdown
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
-	<-quit
+func modifyURLRules(ctx echo.Context) error {
+	name := ctx.Param("name")
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
-	defer cancel()
-	if err := app.Shutdown(ctx); err != nil {
-		app.Logger.Fatal(err)
+	rules := []model.Rule{}
+	err := json.NewDecoder(ctx.Request().Body).Decode(&rules)
+	if err != nil || rules == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid rules")
 	}
-}
 
-func customHTTPErrorHandler(err error, ctx echo.Context) {
-	code := http.StatusInternalServerError
-	if httpError, ok := err.(*echo.HTTPError); ok {
-		code = httpError.Code
+	if len(rules) > maxRules {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("at most %d rules are allowed", maxRules))
 	}
 
-	contentType := ctx.Request().Header.Get(echo.HeaderContentType)
-	switch contentType {
-	case echo.MIMEApplicationJSON, echo.MIMEApplicationJSONCharsetUTF8:
-		ctx.Echo().DefaultHTTPErrorHandler(err, ctx)
-		return
+	for i, rule := range rules {
+		rules[i], err = routing.Normalize(rule)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		err = urlPolicy.Check(ctx.Request().Context(), rule.URL)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
 	}
-	ctx.File(fmt.Sprintf("/static/templates/%d.html", code))
-	ctx.Echo().DefaultHTTPErrorHandler(err, ctx)
-}
 
-func healthCheck(ctx echo.Context) error {
-	err := urlRepo.Health()
+	var url, previous model.URL
+	err = urlRepo.Transaction(ctx.Request().Context(), func(urlTxRepo *repo.Repo) error {
+		previous, err = urlTxRepo.GetByName(ctx.Request().Context(), name)
+		if err != nil {
+			return err
+		}
+
+		url, err = urlTxRepo.UpdateRulesByID(ctx.Request().Context(), previous.ID, rules)
+		if err != nil {
+			return err
+		}
+
+		return auditURL(ctx, urlTxRepo, audit.ActionRules, url.ID, previous, url)
+	})
+
 	if err != nil {
+		if err == repo.ErrNoRows {
+			return echo.ErrBadRequest
+		}
 		ctx.Logger().Error(err)
-		return echo.ErrServiceUnavailable
+		return echo.ErrInternalServerError
 	}
-	return ctx.String(http.StatusOK, "OK\n")
-}
 
-func wrap(vs ...interface{}) []interface{} {
-	return vs
+	if _, exists := urlCache.Read(url.Name); exists {
+		urlCache.Write(url.Name, url)
+	}
+
+	return ctx.JSON(http.StatusOK, url)
 }
 
-func logIfErr(logger echo.Logger, i ...interface{}) {
-	var err error = nil
-	for _, o := range i {
-		switch t := o.(type) {
-		case error:
-			err = t
+func modifyURLPlatforms(ctx echo.Context) error {
+	name := ctx.Param("name")
+
+	platforms := map[string]string{}
+	err := json.NewDecoder(ctx.Request().Body).Decode(&platforms)
+	if err != nil || platforms == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid platforms")
+	}
+
+	for platform, platformURL := range platforms {
+		switch platform {
+		case useragent.PlatformIOS, useragent.PlatformAndroid, useragent.PlatformDesktop:
+		default:
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid platform %s", platform))
+		}
+
+		// Android clients can be sent to apps through intents
+		if platform == useragent.PlatformAndroid && strings.HasPrefix(strings.ToLower(platformURL), "intent:") {
+			err = urlPolicy.CheckIntent(ctx.Request().Context(), platformURL)
+		} else {
+			err = urlPolicy.Check(ctx.Request().Context(), platformURL)
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 		}
 	}
+
+	var url, previous model.URL
+	err = urlRepo.Transaction(ctx.Request().Context(), func(urlTxRepo *repo.Repo) error {
+		previous, err = urlTxRepo.GetByName(ctx.Request().Context(), name)
+		if err != nil {
+			return err
+		}
+
+		url, err = urlTxRepo.UpdatePlatformsByID(ctx.Request().Context(), previous.ID, platforms)
+		if err != nil {
+			return err
+		}
+
+		return auditURL(ctx, urlTxRepo, audit.ActionPlatforms, url.ID, previous, url)
+	})
+
 	if err != nil {
-		logger.Error(err)
+		if err == repo.ErrNoRows {
+			return echo.ErrBadRequest
+		}
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
+	}
+
+	if _, exists := urlCache.Read(url.Name); exists {
+		urlCache.Write(url.Name, url)
 	}
+
+	return ctx.JSON(http.StatusOK, url)
+}
+
+func modifyURLVariants(ctx echo.Context) error {
+	name := ctx.Param("name")
+
+	var body struct {
+		Sticky   bool            `json:"sticky"`
+		Variants []model.Variant `json:"variants"`
+	}
+	err := json.NewDecoder(ctx.Request().Body).Decode(&body)
+	if err != nil || body.Variants == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid variants")
+	}
+
+	if len(body.Variants) > maxVariants {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("at most %d variants are allowed", maxVariants))
+	}
+
+	err = routing.ValidateVariants(body.Variants)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	for _, variant := range body.Variants {
+		err = urlPolicy.Check(ctx.Request().Context(), variant.URL)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	var url, previous model.URL
+	err = urlRepo.Transaction(ctx.Request().Context(), func(urlTxRepo *repo.Repo) error {
+		previous, err = urlTxRepo.GetByName(ctx.Request().Context(), name)
+		if err != nil {
+			return err
+		}
+
+		url, err = urlTxRepo.UpdateVariantsByID(ctx.Request().Context(), previous.ID, body.Variants, body.Sticky)
+		if err != nil {
+			return err
+		}
+
+		return auditURL(ctx, urlTxRepo, audit.ActionVariants, url.ID, previous, url)
+	})
+
+	if err != nil {
+		if err == repo.ErrNoRows {
+			return echo.ErrBadRequest
+		}
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
+	}
+
+	if _, exists := urlCache.Read(url.Name); exists {
+		urlCache.Write(url.Name, url)
+	}
+
+	return ctx.JSON(http.StatusOK, url)
+}
+
+func getURLSchedules(ctx echo.Context) error {
+	name := ctx.Param("name")
+
+	url, err := urlRepo.GetByName(ctx.Request().Context(), name)
+	if err != nil {
+		if err == repo.ErrNoRows {
+			return notFoundOrGone(ctx, name)
+		}
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
+	}
+
+	schedules, err := urlRepo.GetSchedulesByURLID(ctx.Request().Context(), url.ID)
+	if err != nil {
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
+	}
+
+	return ctx.JSON(http.StatusOK, schedules)
+}
+
+func createURLSchedule(ctx echo.Context) error {
+	name := ctx.Param("name")
+	qurl := ctx.QueryParam("url")
+
+	effectiveFrom, err := time.Parse(time.RFC3339, ctx.QueryParam("effective_from"))
+	if err != nil || !effectiveFrom.After(time.Now()) {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid effective_from")
+	}
+
+	err = urlPolicy.Check(ctx.Request().Context(), qurl)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	expandedURL, err := expandURL(ctx, qurl)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	url, err := urlRepo.GetByName(ctx.Request().Context(), name)
+	if err != nil {
+		if err == repo.ErrNoRows {
+			return echo.ErrBadRequest
+		}
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
+	}
+
+	var schedule model.Schedule
+	err = urlRepo.Transaction(ctx.Request().Context(), func(urlTxRepo *repo.Repo) error {
+		schedule, err = urlTxRepo.CreateSchedule(ctx.Request().Context(), model.Schedule{
+			URLID:         url.ID,
+			URL:           qurl,
+			ExpandedURL:   expandedURL,
+			EffectiveFrom: effectiveFrom,
+		})
+		if err != nil {
+			return err
+		}
+
+		return auditURL(ctx, urlTxRepo, audit.ActionSchedule, url.ID, nil, schedule)
+	})
+
+	if err != nil {
+		if err == repo.ErrIntegrityViolation {
+			return echo.ErrBadRequest
+		}
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
+	}
+
+	return ctx.JSON(http.StatusOK, schedule)
+}
+
+func deleteURLSchedule(ctx echo.Context) error {
+	name := ctx.Param("name")
+
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	url, err := urlRepo.GetByName(ctx.Request().Context(), name)
+	if err != nil {
+		if err == repo.ErrNoRows {
+			return echo.ErrBadRequest
+		}
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
+	}
+
+	// Applied schedules are kept, as they already changed the destination
+	var schedule model.Schedule
+	err = urlRepo.Transaction(ctx.Request().Context(), func(urlTxRepo *repo.Repo) error {
+		schedule, err = urlTxRepo.DeletePendingScheduleByID(ctx.Request().Context(), url.ID, id)
+		if err != nil {
+			return err
+		}
+
+		return auditURL(ctx, urlTxRepo, audit.ActionUnschedule, url.ID, schedule, nil)
+	})
+
+	if err != nil {
+		if err == repo.ErrNoRows {
+			return echo.ErrBadRequest
+		}
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
+	}
+
+	return ctx.JSON(http.StatusOK, schedule)
+}
+
+func getURLStats(ctx echo.Context) error {
+	name := ctx.Param("name")
+	contentType := ctx.Request().Header.Get(echo.HeaderContentType)
+
+	url, err := urlRepo.GetByName(ctx.Request().Context(), name)
+	if err != nil {
+		if err == repo.ErrNoRows {
+			return notFoundOrGone(ctx, name)
+		}
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
+	}
+
+	from, to, err := dateRange(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	stats := model.Stats{URL: url}
+
+	// Variant hits are aggregated daily, so they do not scan the clicks
+	stats.VariantHits, err = urlRepo.CountVariantHits(ctx.Request().Context(), url.ID, from, to)
+	if err != nil {
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
+	}
+
+	stats.Changes, err = urlRepo.GetChangesByURLID(ctx.Request().Context(), url.ID, statsChanges, 0)
+	if err != nil {
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
+	}
+
+	sketches, err := urlRepo.GetVisitorSketches(ctx.Request().Context(), url.ID, from, to)
+	if err != nil {
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
+	}
+
+	// Daily sketches merge into the sketch of the whole range
+	visitors := hll.New()
+	for _, sketch := range sketches {
+		visitors.Merge(sketch)
+	}
+	stats.UniqueVisitors = visitors.Count()
+
+	// Charts read the hourly hits, so they do not scan the clicks
+	points, err := urlRepo.GetDailyHits(ctx.Request().Context(), url.ID, from, to)
+	if err != nil {
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
+	}
+	stats.Series = fillDays(points, url.CreatedAt, from, to)
+
+	stats.HourOfWeek, err = urlRepo.GetHourOfWeekHits(ctx.Request().Context(), url.ID, from, to)
+	if err != nil {
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
+	}
+
+	top, err := strconv.Atoi(ctx.QueryParam("top"))
+	if err != nil || top < 1 || top > 100 {
+		top = statsTop
+	}
+
+	stats.Referrers, err = urlRepo.GetTopReferrers(ctx.Request().Context(), url.ID, from, to, top)
+	if err != nil {
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
+	}
+
+	stats.Sources, err = urlRepo.CountReferrersBySource(ctx.Request().Context(), url.ID, from, to)
+	if err != nil {
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
+	}
+
+	stats.Countries, err = urlRepo.CountTopLocationsByCountry(ctx.Request().Context(), url.ID, from, to, top)
+	if err != nil {
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
+	}
+
+	stats.Regions, err = urlRepo.CountTopLocationsByRegion(ctx.Request().Context(), url.ID, from, to, top)
+	if err != nil {
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
+	}
+
+	stats.Browsers, stats.Systems, stats.Devices, err = urlRepo.CountAgents(ctx.Request().Context(), url.ID, from, to)
+	if err != nil {
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
+	}
+
+	switch contentType {
+	case echo.MIMEApplicationJSON, echo.MIMEApplicationJSONCharsetUTF8:
+		return ctx.JSON(http.StatusOK, stats)
+	default:
+		return ctx.Render(http.StatusOK, "stats.gts.html", stats)
+	}
+}
+
+func getURLQR(ctx echo.Context) error {
+	name := ctx.Param("name")
+
+	if _, exists := urlCache.Read(name); !exists {
+		_, err := urlRepo.GetByName(ctx.Request().Context(), name)
+		if err != nil {
+			if err == repo.ErrNoRows {
+				return notFoundOrGone(ctx, name)
+			}
+			ctx.Logger().Error(err)
+			return echo.ErrInternalServerError
+		}
+	}
+
+	format := ctx.QueryParam("format")
+	if format == "" {
+		format = "png"
+	}
+	if format != "png" && format != "svg" {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid format")
+	}
+
+	opts, err := qrOptions(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	content := fmt.Sprintf("%s/%s", render.BaseURL(), nurl.PathEscape(name))
+
+	// The short url of a name never changes, so the image only depends on the options
+	etag := fmt.Sprintf(`"%x"`, sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%v", content, format, opts))))
+	ctx.Response().Header().Set(echo.HeaderCacheControl, "public, max-age=86400")
+	ctx.Response().Header().Set("ETag", etag)
+	if ctx.Request().Header.Get("If-None-Match") == etag {
+		return ctx.NoContent(http.StatusNotModified)
+	}
+
+	if format == "svg" {
+		image, err := qr.SVG(content, opts)
+		if err != nil {
+			ctx.Logger().Error(err)
+			return echo.ErrInternalServerError
+		}
+		return ctx.Blob(http.StatusOK, "image/svg+xml", image)
+	}
+
+	image, err := qr.PNG(content, opts)
+	if err != nil {
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
+	}
+	return ctx.Blob(http.StatusOK, "image/png", image)
+}
+
+func listURLs(ctx echo.Context) error {
+	var filter repo.ListFilter
+	if status := ctx.QueryParam("status"); status != "" {
+		filter.CheckStatus = &status
+	}
+	if minFailures, err := strconv.Atoi(ctx.QueryParam("min_failures")); err == nil {
+		filter.MinCheckFailures = minFailures
+	}
+	filter.Deleted = queryBool(ctx, "deleted", false)
+
+	limit, offset := paginate(ctx)
+
+	urls, err := urlRepo.List(ctx.Request().Context(), filter, limit, offset)
+	if err != nil {
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
+	}
+
+	return ctx.JSON(http.StatusOK, urls)
+}
+
+func listAudit(ctx echo.Context) error {
+	var filter repo.AuditFilter
+	if subject := ctx.QueryParam("subject"); subject != "" {
+		filter.Subject = &subject
+	}
+	if urlID, err := strconv.Atoi(ctx.QueryParam("url_id")); err == nil {
+		filter.URLID = &urlID
+	}
+	if action := ctx.QueryParam("action"); action != "" {
+		filter.Action = &action
+	}
+	if actor := ctx.QueryParam("actor"); actor != "" {
+		filter.Actor = &actor
+	}
+
+	limit, offset := paginate(ctx)
+
+	entries, err := urlRepo.ListAuditEntries(ctx.Request().Context(), filter, limit, offset)
+	if err != nil {
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
+	}
+
+	return ctx.JSON(http.StatusOK, entries)
+}
+
+func verifyAudit(ctx echo.Context) error {
+	var verified int
+	var afterID int64
+	previous := ""
+
+	for {
+		entries, err := urlRepo.GetAuditEntriesAfter(ctx.Request().Context(), afterID, auditVerifyBatchSize)
+		if err != nil {
+			ctx.Logger().Error(err)
+			return echo.ErrInternalServerError
+		}
+
+		var tampered int
+		previous, tampered = auditChain.Verify(previous, entries)
+		if tampered >= 0 {
+			return ctx.JSON(http.StatusOK, model.Verification{
+				Valid:      false,
+				Verified:   verified + tampered,
+				TamperedID: &entries[tampered].ID,
+			})
+		}
+
+		verified += len(entries)
+		if len(entries) < auditVerifyBatchSize {
+			break
+		}
+		afterID = entries[len(entries)-1].ID
+	}
+
+	return ctx.JSON(http.StatusOK, model.Verification{
+		Valid:    true,
+		Verified: verified,
+	})
+}
+
+func exportStats(ctx echo.Context) error {
+	var names []string
+	for _, name := range strings.Split(ctx.QueryParam("names"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 || len(names) > exportMaxNames {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("between 1 and %d names are required", exportMaxNames))
+	}
+
+	from, to, err := dateRange(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if to != nil {
+		// The to day is included, so the range ends the next day
+		next := to.AddDate(0, 0, 1)
+		to = &next
+	}
+	filter := repo.ExportFilter{Names: names, From: from, To: to}
+
+	format := ctx.QueryParam("format")
+	if format == "" {
+		format = export.FormatCSV
+	}
+
+	kind := ctx.QueryParam("kind")
+	header := export.ClickHeader
+	switch kind {
+	case "", "clicks":
+		kind = "clicks"
+	case "series":
+		header = export.PointHeader
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid export kind")
+	}
+
+	interval := ctx.QueryParam("interval")
+	switch interval {
+	case "":
+		interval = "day"
+	case "hour", "day", "week", "month":
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid export interval")
+	}
+
+	res := ctx.Response()
+	encoder, err := export.New(res, format, header)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	// Slow clients keep their export open, so the exports are capped to leave connections to the redirects
+	select {
+	case exportSlots <- struct{}{}:
+		defer func() { <-exportSlots }()
+	default:
+		return echo.NewHTTPError(http.StatusTooManyRequests, "too many exports running")
+	}
+	exporting, cancel := context.WithTimeout(ctx.Request().Context(), exportTimeout)
+	defer cancel()
+
+	// Headers are sent before the first row, so errors past this point abort the response instead
+	res.Header().Set(echo.HeaderContentType, export.ContentType(format))
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", kind+"."+format))
+	res.WriteHeader(http.StatusOK)
+
+	rows := 0
+	write := func(row export.Row) error {
+		if err := encoder.Encode(row); err != nil {
+			return err
+		}
+		// Rows are flushed once per batch, so the client receives the export while it is read
+		if rows++; rows%exportBatchSize == 0 {
+			if err := encoder.Flush(); err != nil {
+				return err
+			}
+			res.Flush()
+		}
+		return nil
+	}
+
+	if kind == "series" {
+		err = urlRepo.ExportSeries(exporting, filter, interval, exportBatchSize, func(point model.Point) error {
+			return write(export.Point{Point: point})
+		})
+	} else {
+		err = urlRepo.ExportClicks(exporting, filter, exportBatchSize, func(name string, click model.Click) error {
+			return write(export.Click{Name: name, Click: click})
+		})
+	}
+	if err != nil {
+		// The response ends without its last chunk, so clients detect the export is incomplete
+		ctx.Logger().Error(err)
+		panic(http.ErrAbortHandler)
+	}
+	logIfErr(ctx.Logger(), encoder.Flush())
+
+	return nil
+}
+
+func listWebhooks(ctx echo.Context) error {
+	webhooks, err := urlRepo.ListWebhooks(ctx.Request().Context())
+	if err != nil {
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
+	}
+
+	// Secrets are only shown when the webhook is created
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+
+	return ctx.JSON(http.StatusOK, webhooks)
+}
+
+func createWebhook(ctx echo.Context) error {
+	var body model.Webhook
+	err := json.NewDecoder(ctx.Request().Body).Decode(&body)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid webhook")
+	}
+
+	err = webhookPolicy.Check(ctx.Request().Context(), body.URL)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	err = webhook.ValidateEvents(body.Events)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if body.Secret == "" {
+		secret := make([]byte, webhookSecretBytes)
+		if _, err := rand.Read(secret); err != nil {
+			ctx.Logger().Error(err)
+			return echo.ErrInternalServerError
+		}
+		body.Secret = hex.EncodeToString(secret)
+	} else if len(body.Secret) < 16 || len(body.Secret) > 128 {
+		return echo.NewHTTPError(http.StatusBadRequest, "secret must be between 16 and 128 characters")
+	}
+
+	var created model.Webhook
+	err = urlRepo.Transaction(ctx.Request().Context(), func(urlTxRepo *repo.Repo) error {
+		created, err = urlTxRepo.CreateWebhook(ctx.Request().Context(), body)
+		if err != nil {
+			return err
+		}
+
+		return auditWebhook(ctx, urlTxRepo, audit.ActionCreate, nil, withoutSecret(&created))
+	})
+	if err != nil {
+		if err == repo.ErrIntegrityViolation {
+			return echo.ErrBadRequest
+		}
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
+	}
+
+	return ctx.JSON(http.StatusCreated, created)
+}
+
+func deleteWebhook(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	var deleted model.Webhook
+	err = urlRepo.Transaction(ctx.Request().Context(), func(urlTxRepo *repo.Repo) error {
+		deleted, err = urlTxRepo.DeleteWebhookByID(ctx.Request().Context(), id)
+		if err != nil {
+			return err
+		}
+
+		return auditWebhook(ctx, urlTxRepo, audit.ActionDelete, withoutSecret(&deleted), nil)
+	})
+	if err != nil {
+		if err == repo.ErrNoRows {
+			return echo.ErrNotFound
+		}
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
+	}
+	deleted.Secret = ""
+
+	return ctx.JSON(http.StatusOK, deleted)
+}
+
+func getWebhookDeliveries(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	var status *string
+	if value := ctx.QueryParam("status"); value != "" {
+		status = &value
+	}
+
+	limit, offset := paginate(ctx)
+
+	deliveries, err := urlRepo.GetDeliveriesByWebhookID(ctx.Request().Context(), id, status, limit, offset)
+	if err != nil {
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
+	}
+
+	return ctx.JSON(http.StatusOK, deliveries)
+}
+
+func getWebhookDelivery(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	deliveryID, err := strconv.ParseInt(ctx.Param("delivery"), 10, 64)
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	delivery, err := urlRepo.GetDeliveryByID(ctx.Request().Context(), id, deliveryID)
+	if err != nil {
+		if err == repo.ErrNoRows {
+			return echo.ErrNotFound
+		}
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
+	}
+
+	attempts, err := urlRepo.GetAttemptsByDeliveryID(ctx.Request().Context(), delivery.ID)
+	if err != nil {
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
+	}
+
+	return ctx.JSON(http.StatusOK, model.DeliveryLog{Delivery: delivery, Log: attempts})
+}
+
+func retryWebhookDelivery(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	deliveryID, err := strconv.ParseInt(ctx.Param("delivery"), 10, 64)
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	// Only dead deliveries are retried, pending deliveries are already being retried
+	var delivery model.Delivery
+	err = urlRepo.Transaction(ctx.Request().Context(), func(urlTxRepo *repo.Repo) error {
+		delivery, err = urlTxRepo.RetryDeadDeliveryByID(ctx.Request().Context(), id, deliveryID)
+		if err != nil {
+			return err
+		}
+
+		return auditWebhook(ctx, urlTxRepo, audit.ActionRetry, nil, delivery)
+	})
+	if err != nil {
+		if err == repo.ErrNoRows {
+			return echo.ErrBadRequest
+		}
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
+	}
+
+	return ctx.JSON(http.StatusOK, delivery)
+}
+
+func main() {
+	var err error
+	appLogger := logger.New("shortr")
+
+	urlRepo, err = repo.Connect(fmt.Sprintf("postgresql://%s:%s@%s:%d/%s?sslmode=%s",
+		config.GetEnvAsString("DATABASE_USER", "postgres"),
+		config.GetEnvAsString("DATABASE_PASSWORD", "postgres"),
+		config.GetEnvAsString("DATABASE_HOST", "postgres"),
+		config.GetEnvAsInt("DATABASE_PORT", 5432),
+		config.GetEnvAsString("DATABASE_NAME", "postgres"),
+		config.GetEnvAsString("DATABASE_SSLMODE", "disable"),
+	), 5, logger.Database(appLogger))
+	if err != nil {
+		panic(err)
+	}
+	defer urlRepo.Disconnect()
+
+	scheme := "http"
+	if config.GetEnvAsBool("APP_SSL_ENABLED", false) {
+		scheme = "https"
+	}
+
+	urlPolicy = policy.New(
+		config.GetEnvAsSlice("POLICY_ALLOWED_SCHEMES", []string{"http", "https"}),
+		config.GetEnvAsSlice("POLICY_ALLOWED_DOMAINS", []string{}),
+		config.GetEnvAsSlice("POLICY_DENIED_DOMAINS", []string{}),
+		config.GetEnvAsSlice("VIRTUAL_HOST", []string{"localhost"}),
+		config.GetEnvAsBool("POLICY_BLOCK_PRIVATE", true),
+		config.GetEnvAsInt("POLICY_MAX_URL_LENGTH", 2048),
+	)
+
+	urlExpander = expander.New(
+		&http.Client{
+			Timeout:   time.Duration(config.GetEnvAsInt("EXPANDER_TIMEOUT", 5)) * time.Second,
+			Transport: urlPolicy.Transport(),
+		},
+		config.GetEnvAsInt("EXPANDER_MAX_REDIRECTS", 10),
+		urlPolicy.Check,
+	)
+
+	urlChecker = checker.New(
+		&http.Client{
+			Timeout:   time.Duration(config.GetEnvAsInt("CHECKER_TIMEOUT", 10)) * time.Second,
+			Transport: urlPolicy.Transport(),
+		},
+		config.GetEnvAsInt("CHECKER_CONCURRENCY", 10),
+	)
+
+	urlFetcher = metadata.New(
+		&http.Client{
+			Timeout:   time.Duration(config.GetEnvAsInt("METADATA_TIMEOUT", 5)) * time.Second,
+			Transport: urlPolicy.Transport(),
+		},
+		int64(config.GetEnvAsInt("METADATA_MAX_BYTES", 512*1024)),
+	)
+
+	webhookPolicy = policy.New(
+		config.GetEnvAsSlice("WEBHOOKS_ALLOWED_SCHEMES", []string{"http", "https"}),
+		config.GetEnvAsSlice("WEBHOOKS_ALLOWED_DOMAINS", []string{}),
+		config.GetEnvAsSlice("WEBHOOKS_DENIED_DOMAINS", []string{}),
+		config.GetEnvAsSlice("VIRTUAL_HOST", []string{"localhost"}),
+		config.GetEnvAsBool("WEBHOOKS_BLOCK_PRIVATE", true),
+		2048,
+	)
+
+	urlSender = webhook.New(&http.Client{
+		Timeout:   time.Duration(config.GetEnvAsInt("WEBHOOKS_TIMEOUT", 10)) * time.Second,
+		Transport: webhookPolicy.Transport(),
+		// Redirects could lead to hosts the policy rejects, so they fail the delivery
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	})
+
+	hitWorkers := config.GetEnvAsInt("HITS_WORKERS", 4)
+	if hitWorkers < 1 {
+		panic(fmt.Sprintf("invalid hit workers %d", hitWorkers))
+	}
+	hitQueueSize := config.GetEnvAsInt("HITS_QUEUE_SIZE", 10000)
+	if hitQueueSize < 0 {
+		panic(fmt.Sprintf("invalid hit queue size %d", hitQueueSize))
+	}
+	hitQueue = make(chan hit, hitQueueSize)
+
+	if exportBatchSize < 1 {
+		panic(fmt.Sprintf("invalid export batch size %d", exportBatchSize))
+	}
+	exportConcurrency := config.GetEnvAsInt("EXPORT_MAX_CONCURRENT", 2)
+	if exportConcurrency < 1 {
+		panic(fmt.Sprintf("invalid export concurrency %d", exportConcurrency))
+	}
+	exportSlots = make(chan struct{}, exportConcurrency)
+
+	for _, milestone := range config.GetEnvAsSlice("WEBHOOKS_MILESTONES", []string{"100", "1000", "10000", "100000", "1000000"}) {
+		hits, err := strconv.Atoi(milestone)
+		if err != nil || hits < 1 {
+			panic(fmt.Sprintf("invalid webhook milestone %q", milestone))
+		}
+		hitMilestones[hits] = true
+	}
+
+	requireLanguage := config.GetEnvAsBool("BOTS_REQUIRE_ACCEPT_LANGUAGE", false)
+	urlDetector = bots.Default(requireLanguage)
+	if path := config.GetEnvAsString("BOTS_PATTERNS_FILE", ""); path != "" {
+		urlDetector, err = bots.Load(path, requireLanguage)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if path := config.GetEnvAsString("GEOIP_DATABASE", ""); path != "" {
+		urlLocator, err = geoip.Open(path)
+		if err != nil {
+			panic(err)
+		}
+		defer urlLocator.Close()
+	}
+
+	var rateLimitStore ratelimit.Store
+	switch store := config.GetEnvAsString("RATELIMIT_STORE", "memory"); store {
+	case "memory":
+		rateLimitStore = ratelimit.NewMemory()
+	case "postgres":
+		rateLimitStore = urlRepo
+	default:
+		panic(fmt.Sprintf("invalid rate limit store %q", store))
+	}
+
+	for _, key := range config.GetEnvAsSlice("RATELIMIT_API_KEYS", []string{}) {
+		if key = strings.TrimSpace(key); key != "" {
+			rateLimitAPIKeys[hashAPIKey(key)] = true
+		}
+	}
+
+	createPolicy := ratelimit.NewPolicy("create",
+		config.GetEnvAsInt("RATELIMIT_CREATE_PER_MINUTE", 10),
+		config.GetEnvAsInt("RATELIMIT_CREATE_BURST", 20),
+	)
+	modifyPolicy := ratelimit.NewPolicy("modify",
+		config.GetEnvAsInt("RATELIMIT_MODIFY_PER_MINUTE", 60),
+		config.GetEnvAsInt("RATELIMIT_MODIFY_BURST", 30),
+	)
+	redirectPolicy := ratelimit.NewPolicy("redirect",
+		config.GetEnvAsInt("RATELIMIT_REDIRECT_PER_MINUTE", 600),
+		config.GetEnvAsInt("RATELIMIT_REDIRECT_BURST", 100),
+	)
+
+	limitCreate := rateLimit(rateLimitStore, createPolicy)
+	limitModify := rateLimit(rateLimitStore, modifyPolicy)
+	limitRedirect := rateLimit(rateLimitStore, redirectPolicy)
+	adminOnly := adminAuth()
+
+	app := echo.New()
+	app.Logger = logger.Standard(appLogger)
+	app.HTTPErrorHandler = customHTTPErrorHandler
+	app.Renderer = render.New("/static/templates/*.gts.html")
+	app.IPExtractor = echo.ExtractIPFromRealIPHeader()
+
+	// A random secret would make the chain unverifiable after restarts
+	if len(auditSecret) == 0 {
+		panic("AUDIT_SECRET is required")
+	}
+	auditChain = audit.New(auditSecret)
+
+	if len(visitorsSalt) == 0 {
+		// Fingerprints then differ between instances and restarts, so visitors are overcounted
+		app.Logger.Warn("VISITORS_SALT is not set, using a random salt")
+		visitorsSalt = make([]byte, 32)
+		if _, err := rand.Read(visitorsSalt); err != nil {
+			panic(err)
+		}
+	}
+
+	app.Pre(middleware.RemoveTrailingSlash())
+	app.Use(middleware.RequestID())
+	app.Use(logger.Middleware(appLogger, clientIP))
+	app.Use(middleware.Recover())
+	app.Use(middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOrigins: []string{fmt.Sprintf("%s://%s",
+			scheme,
+			config.GetEnvAsSlice("VIRTUAL_HOST", []string{"localhost"})[0]),
+		}, // Add more origins if required
+		AllowMethods: []string{http.MethodGet, http.MethodPost, http.MethodDelete, http.MethodPut},
+	}))
+
+	routes(app, "/static", limitCreate, limitModify, limitRedirect, adminOnly)
+
+	app.Logger.Infof("Paths reserved on prefix urls: %s", strings.Join(reservedPaths(app), ", "))
+
+	// Jobs
+	jobs, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	if config.GetEnvAsBool("CHECKER_ENABLED", true) {
+		go schedule(jobs, time.Duration(config.GetEnvAsInt("CHECKER_INTERVAL", 60))*time.Second, checkURLs(app.Logger,
+			time.Duration(config.GetEnvAsInt("CHECKER_RECHECK_AFTER", 86400))*time.Second,
+			config.GetEnvAsInt("CHECKER_BATCH_SIZE", 100),
+		))
+	}
+
+	if config.GetEnvAsBool("SCHEDULER_ENABLED", true) {
+		interval := time.Duration(config.GetEnvAsInt("SCHEDULER_INTERVAL", 10)) * time.Second
+		go schedule(jobs, interval, applySchedules(app.Logger, interval, config.GetEnvAsInt("SCHEDULER_BATCH_SIZE", 100)))
+	}
+
+	if rateLimitEnabled {
+		// Buckets idle for longer than their refill time are full, so they are the same as new buckets
+		idle := createPolicy.RefillTime()
+		for _, policy := range []ratelimit.Policy{modifyPolicy, redirectPolicy} {
+			if policy.RefillTime() > idle {
+				idle = policy.RefillTime()
+			}
+		}
+		go schedule(jobs, time.Minute, sweepBuckets(app.Logger, rateLimitStore, idle))
+	}
+
+	if urlLocator != nil {
+		go schedule(jobs, time.Duration(config.GetEnvAsInt("GEOIP_RELOAD_INTERVAL", 60))*time.Second, reloadGeoIP(app.Logger))
+	}
+
+	if config.GetEnvAsBool("TRASH_PURGE_ENABLED", true) {
+		go schedule(jobs, time.Duration(config.GetEnvAsInt("TRASH_PURGE_INTERVAL", 3600))*time.Second, purgeURLs(app.Logger, trashGracePeriod))
+	}
+
+	if config.GetEnvAsBool("WEBHOOKS_ENABLED", true) {
+		batchSize := config.GetEnvAsInt("WEBHOOKS_BATCH_SIZE", 50)
+		concurrency := config.GetEnvAsInt("WEBHOOKS_CONCURRENCY", 10)
+		if concurrency < 1 {
+			concurrency = 1
+		}
+		// Claimed deliveries are leased for longer than the slowest batch can take
+		lease := time.Duration(config.GetEnvAsInt("WEBHOOKS_TIMEOUT", 10)) * time.Second * time.Duration((batchSize+concurrency-1)/concurrency+1)
+		go schedule(jobs, time.Duration(config.GetEnvAsInt("WEBHOOKS_INTERVAL", 5))*time.Second, deliverWebhooks(app.Logger, batchSize, concurrency, lease,
+			config.GetEnvAsInt("WEBHOOKS_MAX_ATTEMPTS", 10),
+			time.Duration(config.GetEnvAsInt("WEBHOOKS_BACKOFF_BASE", 30))*time.Second,
+			time.Duration(config.GetEnvAsInt("WEBHOOKS_BACKOFF_MAX", 21600))*time.Second,
+		))
+		retention := time.Duration(config.GetEnvAsInt("WEBHOOKS_RETENTION", 2592000)) * time.Second
+		go schedule(jobs, time.Hour, purgeDeliveries(app.Logger, retention))
+	}
+
+	// Hits are recorded by a fixed number of workers, so bursts of redirects do not pile up goroutines and connections
+	var recording sync.WaitGroup
+	recording.Add(hitWorkers)
+	for i := 0; i < hitWorkers; i++ {
+		go recordHits(app.Logger, hitQueue, &recording)
+	}
+
+	// Drops are logged periodically, as logging each of them would flood the log while the queue is full
+	go schedule(jobs, time.Minute, logDroppedHits(app.Logger))
+
+	go func() {
+		if err := app.Start(fmt.Sprintf(":%d", config.GetEnvAsInt("APP_PORT", 80))); err != nil && err != http.ErrServerClosed {
+			app.Logger.Fatal(err)
+		}
+	}()
+
+	// Graceful shutdown
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
+
+	stopJobs()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	if err := app.Shutdown(ctx); err != nil {
+		app.Logger.Fatal(err)
+	}
+
+	// Redirects are over, so the hits left in the queue are recorded before exiting
+	close(hitQueue)
+	recording.Wait()
+	logDroppedHits(app.Logger)(context.Background())
+}
+
+// routes registers the routes of the app, serving the assets from the static directory
+func routes(app *echo.Echo, static string, limitCreate, limitModify, limitRedirect, adminOnly echo.MiddlewareFunc) {
+	// Assets are registered apart from the root, otherwise the prefix urls would take their paths
+	for _, dir := range staticDirs {
+		app.Static("/"+dir, filepath.Join(static, dir))
+	}
+	app.Static("/", static)
+	app.GET("/health", healthCheck)
+	app.GET("/urls", listURLs, adminOnly)
+	app.GET("/audit", listAudit, adminOnly)
+	app.GET("/audit/verify", verifyAudit, adminOnly, limitModify)
+	app.GET("/export", exportStats, adminOnly, limitModify)
+	app.GET("/webhooks", listWebhooks, adminOnly)
+	app.POST("/webhooks", createWebhook, adminOnly, limitModify)
+	app.DELETE("/webhooks/:id", deleteWebhook, adminOnly, limitModify)
+	app.GET("/webhooks/:id/deliveries", getWebhookDeliveries, adminOnly)
+	app.GET("/webhooks/:id/deliveries/:delivery", getWebhookDelivery, adminOnly)
+	app.POST("/webhooks/:id/deliveries/:delivery/retry", retryWebhookDelivery, adminOnly, limitModify)
+	app.POST("/", shortenURL, limitCreate)
+	url := app.Group("/:name")
+	/*--*/ url.GET("", getURL, limitRedirect)
+	/*--*/ url.POST("", shortenURL, limitCreate)
+	/*--*/ url.DELETE("", deleteURL, limitModify)
+	/*--*/ url.POST("/restore", restoreURL, limitModify)
+	/*--*/ url.PUT("", modifyURL, limitModify)
+	/*--*/ url.GET("/stats", getURLStats)
+	/*--*/ url.GET("/qr", getURLQR)
+	/*--*/ url.PUT("/rules", modifyURLRules, limitModify)
+	/*--*/ url.PUT("/platforms", modifyURLPlatforms, limitModify)
+	/*--*/ url.PUT("/variants", modifyURLVariants, limitModify)
+	/*--*/ url.GET("/schedules", getURLSchedules)
+	/*--*/ url.POST("/schedules", createURLSchedule, limitModify)
+	/*--*/ url.DELETE("/schedules/:id", deleteURLSchedule, limitModify)
+	/*--*/ url.GET("/history", getURLHistory)
+	/*--*/ url.POST("/history/:id/rollback", rollbackURL, limitModify)
+	/*--*/ url.GET("/*", getURL, limitRedirect) // Only prefix urls, the sub-routes above are reserved
+}
+
+func customHTTPErrorHandler(err error, ctx echo.Context) {
+	code := http.StatusInternalServerError
+	if httpError, ok := err.(*echo.HTTPError); ok {
+		code = httpError.Code
+	}
+
+	contentType := ctx.Request().Header.Get(echo.HeaderContentType)
+	switch contentType {
+	case echo.MIMEApplicationJSON, echo.MIMEApplicationJSONCharsetUTF8:
+		ctx.Echo().DefaultHTTPErrorHandler(err, ctx)
+		return
+	}
+	ctx.File(fmt.Sprintf("/static/templates/%d.html", code))
+	ctx.Echo().DefaultHTTPErrorHandler(err, ctx)
+}
+
+func healthCheck(ctx echo.Context) error {
+	err := urlRepo.Health()
+	if err != nil {
+		ctx.Logger().Error(err)
+		return echo.ErrServiceUnavailable
+	}
+	return ctx.String(http.StatusOK, "OK\n")
+}
+
+func wrap(vs ...interface{}) []interface{} {
+	return vs
+}
+
+func logIfErr(logger echo.Logger, i ...interface{}) {
+	var err error = nil
+	for _, o := range i {
+		switch t := o.(type) {
+		case error:
+			err = t
+		}
+	}
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+// notFoundOrGone tells apart urls which never existed from urls in the trash
+func notFoundOrGone(ctx echo.Context, name string) error {
+	_, err := urlRepo.GetDeletedByName(ctx.Request().Context(), name)
+	if err != nil {
+		if err == repo.ErrNoRows {
+			return echo.ErrNotFound
+		}
+		ctx.Logger().Error(err)
+		return echo.ErrInternalServerError
+	}
+	return echo.NewHTTPError(http.StatusGone)
+}
+
+// redirect counts a hit and sends the client to the destination of the url,
+// forwarding the remaining path of prefix urls and passing through the incoming query if enabled
+func redirect(ctx echo.Context, url model.URL) error {
+	agent := useragent.Parse(ctx.Request().UserAgent())
+	// Only the location is kept, the ip is never stored
+	location := urlLocator.Locate(ctx.RealIP())
+
+	destination, variantName, err := resolve(ctx, url, agent, location, ctx.QueryParams())
+	if err != nil {
+		return err
+	}
+
+	source := referrer.Parse(ctx.Request().Referer())
+	click := model.Click{
+		URLID:   url.ID,
+		OS:      agent.OS,
+		Device:  agent.Device,
+		Variant: variantName,
+		Bot:     urlDetector.IsBot(ctx.Request()),
+		Source:  source.Source,
+		Browser: agent.Browser,
+	}
+	if source.Domain != "" {
+		click.Referrer = &source.Domain
+	}
+	if location.Country != "" {
+		click.Country = &location.Country
+	}
+	if location.Region != "" {
+		click.Region = &location.Region
+	}
+
+	// Redirects never wait for the database, so hits are dropped while the queue is full
+	select {
+	case hitQueue <- hit{url: url, visitor: visitorHash(ctx), click: click}:
+	default:
+		droppedHits.Add(1)
+	}
+
+	return ctx.Redirect(http.StatusTemporaryRedirect, destination) // HTTP CODE 307 IN ORDER NOT TO GET URLs CACHED
+}
+
+// resolve returns the destination of the visit to the url, with the forwarded path and the passed through query,
+// and the name of the picked variant, if any
+func resolve(ctx echo.Context, url model.URL, agent useragent.Agent, location geoip.Location, query nurl.Values) (string, *string, error) {
+	path := ctx.Param("*")
+	if path != "" && !url.Prefix {
+		return "", nil, echo.ErrNotFound
+	}
+
+	// Params are only escaped when the raw path is not the default encoding
+	if ctx.Request().URL.RawPath != "" {
+		if unescaped, err := nurl.PathUnescape(path); err == nil {
+			path = unescaped
+		}
+	}
+
+	// Platform destinations take precedence over rules, as other platforms cannot open them,
+	// and both over variants, which only split the traffic of the default destination
+	var matches bool
+	var variantName *string
+	destination := url.Destination()
+	if platformURL, exists := url.Platforms[agent.Platform()]; exists {
+		destination, matches = platformURL, true
+	} else if len(url.Rules) > 0 {
+		visitor := routing.NewVisitor(location.Country, ctx.Request().Header.Get("Accept-Language"))
+		var ruleURL string
+		if ruleURL, matches = routing.Match(url.Rules, visitor); matches {
+			destination = ruleURL
+		}
+	}
+
+	if !matches && len(url.Variants) > 0 {
+		if variant, exists := pickVariant(ctx, url); exists {
+			destination = variant.URL
+			variantName = &variant.Name
+		}
+	}
+
+	destination, err := passthrough.Forward(destination, path)
+	if err != nil {
+		if err == passthrough.ErrInvalidPath {
+			return "", nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		ctx.Logger().Error(err)
+		return "", nil, echo.ErrInternalServerError
+	}
+
+	destination, err = passthrough.Apply(destination, url.QueryMode, query)
+	if err != nil {
+		ctx.Logger().Error(err)
+		return "", nil, echo.ErrInternalServerError
+	}
+
+	return destination, variantName, nil
+}
+
+// visitorHash fingerprints the visitor by its IP and user agent, salted so the fingerprint cannot be reversed
+func visitorHash(ctx echo.Context) uint64 {
+	mac := hmac.New(sha256.New, visitorsSalt)
+	mac.Write([]byte(ctx.RealIP()))
+	mac.Write([]byte{0})
+	mac.Write([]byte(ctx.Request().UserAgent()))
+	return binary.BigEndian.Uint64(mac.Sum(nil))
+}
+
+// pickVariant chooses a weighted variant of the url, remembering it in a cookie when variants are sticky
+func pickVariant(ctx echo.Context, url model.URL) (model.Variant, bool) {
+	cookieName := fmt.Sprintf("shortr_variant_%d", url.ID)
+
+	if url.StickyVariants {
+		if cookie, err := ctx.Cookie(cookieName); err == nil {
+			// Variants with no weight left are retired, so their visitors are reassigned
+			if variant, exists := routing.Find(url.Variants, cookie.Value); exists && variant.Weight > 0 {
+				return variant, true
+			}
+		}
+	}
+
+	variant, exists := routing.Pick(url.Variants)
+	if !exists {
+		return variant, false
+	}
+
+	if url.StickyVariants {
+		ctx.SetCookie(&http.Cookie{
+			Name:     cookieName,
+			Value:    variant.Name,
+			Path:     "/",
+			MaxAge:   stickyVariantsMaxAge,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	return variant, true
+}
+
+// hit describes a redirect whose metrics are still to be recorded
+type hit struct {
+	url     model.URL
+	visitor uint64
+	click   model.Click
+}
+
+// recordHits records the queued hits until the queue is closed, each worker uses one database connection at a time
+func recordHits(logger echo.Logger, queue <-chan hit, done *sync.WaitGroup) {
+	defer done.Done()
+	for queued := range queue {
+		recordHit(logger, queued.url, queued.visitor, queued.click)
+	}
+}
+
+// recordHit updates the metrics of the url and stores the click.
+// It runs after the response is sent, when the request context is already canceled.
+func recordHit(logger echo.Logger, url model.URL, visitor uint64, click model.Click) {
+	ctx := context.Background()
+	// Bots are counted apart, so hits are only human visits
+	if click.Bot {
+		logIfErr(logger, wrap(urlRepo.UpdateBotMetricsByID(ctx, url.ID))...)
+	} else {
+		updated, err := urlRepo.UpdateMetricsByID(ctx, url.ID)
+		logIfErr(logger, err)
+		// Hits are incremented atomically, so each milestone is reached by exactly one hit
+		if err == nil && hitMilestones[updated.Hits] {
+			logIfErr(logger, notify(ctx, urlRepo, webhook.EventMilestone, &updated.Hits, audit.Snapshot(updated)))
+		}
+		index, rank := hll.Position(visitor)
+		logIfErr(logger, urlRepo.AddVisitor(ctx, url.ID, time.Now().UTC(), hll.Registers, index, rank))
+		domain := ""
+		if click.Referrer != nil {
+			domain = *click.Referrer
+		}
+		logIfErr(logger, urlRepo.AddReferrer(ctx, url.ID, time.Now().UTC(), domain, click.Source))
+		country, region := "", ""
+		if click.Country != nil {
+			country = *click.Country
+		}
+		if click.Region != nil {
+			region = *click.Region
+		}
+		logIfErr(logger, urlRepo.AddLocation(ctx, url.ID, time.Now().UTC(), country, region))
+		logIfErr(logger, urlRepo.AddAgent(ctx, url.ID, time.Now().UTC(), click.Browser, click.OS, click.Device))
+		if click.Variant != nil {
+			logIfErr(logger, urlRepo.AddVariantHit(ctx, url.ID, time.Now().UTC(), *click.Variant))
+		}
+	}
+	logIfErr(logger, urlRepo.AddHit(ctx, url.ID, time.Now(), click.Bot))
+	logIfErr(logger, wrap(urlRepo.CreateClick(ctx, click))...)
+}
+
+// parseOptions gets the optional query_mode and prefix query params, which are nil when not present
+func parseOptions(ctx echo.Context) (*string, *bool, error) {
+	var queryMode *string
+	if value := ctx.QueryParam("query_mode"); value != "" {
+		if !passthrough.Valid(value) {
+			return nil, nil, passthrough.ErrInvalidMode
+		}
+		queryMode = &value
+	}
+
+	var prefix *bool
+	if value := ctx.QueryParam("prefix"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, nil, errors.New("invalid prefix")
+		}
+		prefix = &parsed
+	}
+
+	return queryMode, prefix, nil
+}
+
+// updateURL checks and stores the new destination of the url by its name, recording the change in its history
+func updateURL(ctx echo.Context, action string, name string, qurl string, queryMode *string, prefix *bool) (model.URL, error) {
+	err := urlPolicy.Check(ctx.Request().Context(), qurl)
+	if err != nil {
+		return model.URL{}, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	expandedURL, err := expandURL(ctx, qurl)
+	if err != nil {
+		return model.URL{}, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	var url, previous model.URL
+	err = urlRepo.Transaction(ctx.Request().Context(), func(urlTxRepo *repo.Repo) error {
+		previous, err = urlTxRepo.GetByName(ctx.Request().Context(), name)
+		if err != nil {
+			return err
+		}
+
+		url, err = urlTxRepo.UpdateURLByID(ctx.Request().Context(), previous.ID, qurl, expandedURL)
+		if err != nil {
+			return err
+		}
+
+		err = recordChange(ctx.Request().Context(), urlTxRepo, &previous.URL, url, actorOf(ctx))
+		if err != nil {
+			return err
+		}
+
+		url, err = updateOptions(ctx, urlTxRepo, url, queryMode, prefix)
+		if err != nil {
+			return err
+		}
+
+		return auditURL(ctx, urlTxRepo, action, url.ID, previous, url)
+	})
+
+	if err != nil {
+		if err == repo.ErrNoRows || err == repo.ErrIntegrityViolation {
+			return url, echo.ErrBadRequest
+		}
+		ctx.Logger().Error(err)
+		return url, echo.ErrInternalServerError
+	}
+
+	url = fetchMetadata(ctx, url)
+
+	if _, exists := urlCache.Read(url.Name); exists {
+		urlCache.Write(url.Name, url)
+	}
+
+	return url, nil
+}
+
+// recordChange stores the destination change of the url in its history, unless the destination is the same
+func recordChange(ctx context.Context, urlRepo *repo.Repo, oldURL *string, url model.URL, actor string) error {
+	if oldURL != nil && *oldURL == url.URL {
+		return nil
+	}
+
+	_, err := urlRepo.CreateChange(ctx, model.Change{
+		URLID:  url.ID,
+		OldURL: oldURL,
+		NewURL: url.URL,
+		Actor:  actor,
+	})
+	return err
+}
+
+// auditURL records the mutation of the url made by the request in the audit log, within the transaction of the mutation
+func auditURL(ctx echo.Context, urlTxRepo *repo.Repo, action string, urlID int, before interface{}, after interface{}) error {
+	return recordAudit(ctx.Request().Context(), urlTxRepo, requestEntry(ctx, urlEntry(action, urlID, actorOf(ctx))), before, after)
+}
+
+// auditWebhook records the admin action on a webhook or its deliveries in the audit log
+func auditWebhook(ctx echo.Context, urlTxRepo *repo.Repo, action string, before interface{}, after interface{}) error {
+	entry := model.AuditEntry{Subject: audit.SubjectWebhook, Action: action, Actor: actorOf(ctx)}
+	return recordAudit(ctx.Request().Context(), urlTxRepo, requestEntry(ctx, entry), before, after)
+}
+
+// withoutSecret returns a copy of the webhook without its secret, so secrets never reach the audit log
+func withoutSecret(hook *model.Webhook) interface{} {
+	if hook == nil {
+		return nil
+	}
+	snapshot := *hook
+	snapshot.Secret = ""
+	return snapshot
+}
+
+// urlEntry returns the audit entry of the action on the url
+func urlEntry(action string, urlID int, actor string) model.AuditEntry {
+	return model.AuditEntry{Subject: audit.SubjectURL, Action: action, URLID: &urlID, Actor: actor}
+}
+
+// requestEntry fills the audit entry with the client of the request
+func requestEntry(ctx echo.Context, entry model.AuditEntry) model.AuditEntry {
+	entry.IP = clientIP(ctx)
+	entry.UserAgent = ctx.Request().UserAgent()
+	entry.RequestID = ctx.Response().Header().Get(echo.HeaderXRequestID)
+	return entry
+}
+
+// recordAudit appends the entry to the audit log within the transaction of the mutation, so it is committed along with it
+func recordAudit(ctx context.Context, urlTxRepo *repo.Repo, entry model.AuditEntry, before interface{}, after interface{}) error {
+	entry.Before = audit.Snapshot(before)
+	entry.After = audit.Snapshot(after)
+
+	_, err := urlTxRepo.AppendAuditEntry(ctx, entry, auditChain.Hash)
+	if err != nil {
+		return err
+	}
+
+	// Url mutations are all audited, so their events are queued along with the same snapshots
+	if event, exists := webhook.EventOf(entry.Action); exists && entry.Subject == audit.SubjectURL {
+		data := entry.After
+		if data == nil {
+			data = entry.Before
+		}
+		return notify(ctx, urlTxRepo, event, nil, data)
+	}
+
+	return nil
+}
+
+// notify queues the event for the webhooks subscribed to it, data is the snapshot of the url
+func notify(ctx context.Context, urlRepo *repo.Repo, event string, milestone *int, data json.RawMessage) error {
+	payload, err := json.Marshal(webhook.Payload{
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+		Milestone: milestone,
+		Data:      data,
+	})
+	if err != nil {
+		return err
+	}
+	return urlRepo.EnqueueDeliveries(ctx, event, payload)
+}
+
+// adminAuth restricts the routes to the requests with the ADMIN_TOKEN as bearer token, they are not found when it is not set
+func adminAuth() echo.MiddlewareFunc {
+	if len(adminToken) == 0 {
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(ctx echo.Context) error {
+				return echo.ErrNotFound
+			}
+		}
+	}
+	return middleware.KeyAuthWithConfig(middleware.KeyAuthConfig{
+		Validator: func(key string, ctx echo.Context) (bool, error) {
+			return subtle.ConstantTimeCompare([]byte(key), adminToken) == 1, nil
+		},
+		ErrorHandler: func(err error, ctx echo.Context) error {
+			return echo.ErrUnauthorized
+		},
+	})
+}
+
+// rateLimit limits the requests of each client with the policy, unless rate limiting is disabled
+func rateLimit(store ratelimit.Store, policy ratelimit.Policy) echo.MiddlewareFunc {
+	if !rateLimitEnabled {
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return next
+		}
+	}
+	return ratelimit.Middleware(store, policy, rateLimitKey)
+}
+
+// rateLimitKey identifies the client by its API key, when it is one of the configured keys, or by its IP.
+// Unknown keys are ignored, so clients can not get fresh buckets by sending made up keys.
+func rateLimitKey(ctx echo.Context) string {
+	if key := ctx.Request().Header.Get("X-API-Key"); key != "" {
+		// Keys are hashed, so they are never stored
+		if hash := hashAPIKey(key); rateLimitAPIKeys[hash] {
+			return "key:" + hash
+		}
+	}
+	return "ip:" + clientIP(ctx)
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// reservedPaths gets the paths of the GET sub-routes of urls, which take precedence over the paths of prefix urls
+func reservedPaths(app *echo.Echo) []string {
+	paths := []string{}
+	for _, route := range app.Routes() {
+		path := strings.TrimPrefix(route.Path, "/:name/")
+		if route.Method == http.MethodGet && path != route.Path && path != "*" {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// actorOf identifies who made the request
+func actorOf(ctx echo.Context) string {
+	return clientIP(ctx)
+}
+
+// clientIP gets the IP of the client to be stored, pseudonymized with the visitors salt when GeoIP is enabled,
+// so the IPs of visitors whose locations are known are never stored along with them
+func clientIP(ctx echo.Context) string {
+	if urlLocator == nil {
+		return ctx.RealIP()
+	}
+	mac := hmac.New(sha256.New, visitorsSalt)
+	mac.Write([]byte(ctx.RealIP()))
+	// Half of the hash fits the columns of IPs and is still unique in practice
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// updateOptions updates the options of the url which are present, keeping the rest, and returns the updated url
+func updateOptions(ctx echo.Context, urlRepo *repo.Repo, url model.URL, queryMode *string, prefix *bool) (model.URL, error) {
+	if queryMode == nil && prefix == nil {
+		return url, nil
+	}
+
+	if queryMode == nil {
+		queryMode = &url.QueryMode
+	}
+	if prefix == nil {
+		prefix = &url.Prefix
+	}
+
+	return urlRepo.UpdateOptionsByID(ctx.Request().Context(), url.ID, *queryMode, *prefix)
+}
+
+// expandURL follows the redirects of the url if requested, or enabled by default,
+// and returns the final url only when it differs from the original one
+func expandURL(ctx echo.Context, url string) (*string, error) {
+	if !queryBool(ctx, "expand", expandByDefault) {
+		return nil, nil
+	}
+
+	// Every url of the chain is checked against the policy before being requested
+	expandedURL, err := urlExpander.Expand(ctx.Request().Context(), url)
+	if err != nil {
+		switch {
+		case err == expander.ErrTooManyRedirects || err == expander.ErrLoop || policy.IsViolation(err):
+			return nil, err
+		case errors.Is(err, policy.ErrPrivateAddress):
+			// The host only resolved to a private address when connecting
+			return nil, policy.ErrPrivateAddress
+		}
+		// Unreachable destinations are stored as they are
+		ctx.Logger().Warn(err)
+		return nil, nil
+	}
+
+	if expandedURL == url {
+		return nil, nil
+	}
+
+	return &expandedURL, nil
+}
+
+// checkURLs probes the destinations not checked since recheckAfter, batchSize at a time
+func checkURLs(logger echo.Logger, recheckAfter time.Duration, batchSize int) func(context.Context) {
+	return func(ctx context.Context) {
+		urls, err := urlRepo.ClaimForCheck(ctx, time.Now().Add(-recheckAfter), batchSize)
+		if err != nil {
+			logger.Error(err)
+			return
+		}
+
+		destinations := make([]string, 0, len(urls))
+		for _, url := range urls {
+			destinations = append(destinations, url.Destination())
+		}
+
+		for i, result := range urlChecker.CheckAll(ctx, destinations) {
+			logIfErr(logger, wrap(urlRepo.UpdateCheckByID(ctx, urls[i].ID, result.Status, result.Code, result.Failed()))...)
+		}
+	}
+}
+
+// applySchedules changes the destination of the urls whose schedules are due, and removes from the cache
+// the urls changed by any instance, applied schedules are looked up with an interval of overlap for clock skew
+func applySchedules(logger echo.Logger, interval time.Duration, batchSize int) func(context.Context) {
+	appliedAfter := time.Now().Add(-interval)
+
+	return func(ctx context.Context) {
+		var urls []model.URL
+		err := urlRepo.Transaction(ctx, func(urlTxRepo *repo.Repo) error {
+			// The transaction may be retried, so only the urls of the last attempt are kept
+			urls = nil
+			schedules, err := urlTxRepo.ClaimDueSchedules(ctx, time.Now(), batchSize)
+			if err != nil {
+				return err
+			}
+
+			// Schedules are ordered by effective time, so the latest due one is the final destination
+			for _, schedule := range schedules {
+				previous, err := urlTxRepo.GetByID(ctx, schedule.URLID)
+				if err != nil {
+					return err
+				}
+
+				url, err := urlTxRepo.UpdateURLByID(ctx, schedule.URLID, schedule.URL, schedule.ExpandedURL)
+				if err != nil {
+					return err
+				}
+
+				err = recordChange(ctx, urlTxRepo, &previous.URL, url, schedulerActor)
+				if err != nil {
+					return err
+				}
+
+				_, err = urlTxRepo.UpdateScheduleAppliedByID(ctx, schedule.ID)
+				if err != nil {
+					return err
+				}
+
+				err = recordAudit(ctx, urlTxRepo, urlEntry(audit.ActionUpdate, url.ID, schedulerActor), previous, url)
+				if err != nil {
+					return err
+				}
+
+				urls = append(urls, url)
+			}
+
+			return nil
+		})
+		if err != nil {
+			logger.Error(err)
+			return
+		}
+
+		for _, url := range urls {
+			urlCache.Remove(url.Name)
+			if metadataByDefault {
+				refreshMetadata(ctx, logger, url)
+			}
+		}
+
+		now := time.Now()
+		names, err := urlRepo.GetNamesAppliedSince(ctx, appliedAfter)
+		if err != nil {
+			logger.Error(err)
+			return
+		}
+		appliedAfter = now.Add(-interval)
+
+		for _, name := range names {
+			urlCache.Remove(name)
+		}
+	}
+}
+
+// purgeURLs permanently deletes the urls in the trash for longer than the grace period
+func purgeURLs(logger echo.Logger, gracePeriod time.Duration) func(context.Context) {
+	return func(ctx context.Context) {
+		var urls []model.URL
+		err := urlRepo.Transaction(ctx, func(urlTxRepo *repo.Repo) error {
+			var err error
+			urls, err = urlTxRepo.PurgeDeleted(ctx, time.Now().Add(-gracePeriod))
+			if err != nil {
+				return err
+			}
+
+			for _, url := range urls {
+				err = recordAudit(ctx, urlTxRepo, urlEntry(audit.ActionPurge, url.ID, purgerActor), url, nil)
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			logger.Error(err)
+			return
+		}
+
+		if len(urls) > 0 {
+			logger.Infof("purged %d deleted urls", len(urls))
+		}
+	}
+}
+
+// reloadGeoIP reopens the GeoIP database when its file changes
+func reloadGeoIP(logger echo.Logger) func(context.Context) {
+	return func(ctx context.Context) {
+		reloaded, err := urlLocator.Reload()
+		if err != nil {
+			logger.Error(err)
+			return
+		}
+		if reloaded {
+			logger.Info("GeoIP database reloaded")
+		}
+	}
+}
+
+// deliverWebhooks sends the due deliveries, batchSize at a time and at most concurrency at once,
+// and schedules the retries of the failed ones until they are dead after maxAttempts
+func deliverWebhooks(logger echo.Logger, batchSize int, concurrency int, lease time.Duration, maxAttempts int,
+	backoffBase time.Duration, backoffMax time.Duration) func(context.Context) {
+	return func(ctx context.Context) {
+		deliveries, err := urlRepo.ClaimDueDeliveries(ctx, time.Now(), lease, batchSize)
+		if err != nil {
+			logger.Error(err)
+			return
+		}
+
+		webhooks := map[int]model.Webhook{}
+		for _, delivery := range deliveries {
+			if _, exists := webhooks[delivery.WebhookID]; !exists {
+				webhooks[delivery.WebhookID], err = urlRepo.GetWebhookByID(ctx, delivery.WebhookID)
+				logIfErr(logger, err)
+			}
+		}
+
+		semaphore := make(chan struct{}, concurrency)
+		var wg sync.WaitGroup
+
+		for _, delivery := range deliveries {
+			hook, exists := webhooks[delivery.WebhookID]
+			if !exists || hook.ID == 0 {
+				continue // Deleted meanwhile, its deliveries are deleted too
+			}
+
+			semaphore <- struct{}{}
+			wg.Add(1)
+			go func(hook model.Webhook, delivery model.Delivery) {
+				defer func() {
+					<-semaphore
+					wg.Done()
+				}()
+
+				attempt := model.Attempt{DeliveryID: delivery.ID, AttemptedAt: time.Now()}
+				// The policy is checked again, as the domain may resolve to other addresses since the webhook was created
+				err := webhookPolicy.Check(ctx, hook.URL)
+				if err == nil {
+					attempt.Code, err = urlSender.Send(ctx, hook.URL, hook.Secret, delivery.ID, delivery.Event, delivery.Payload)
+				}
+				attempt.Duration = int(time.Since(attempt.AttemptedAt).Milliseconds())
+
+				// Attempts interrupted by the shutdown are not counted, the lease lets another run retry them
+				if ctx.Err() != nil {
+					return
+				}
+
+				status, nextAttemptAt := webhook.StatusDelivered, time.Now()
+				if err != nil {
+					message := err.Error()
+					attempt.Error = &message
+					status, nextAttemptAt = webhook.StatusPending, time.Now().Add(webhook.Backoff(delivery.Attempts+1, backoffBase, backoffMax))
+					if delivery.Attempts+1 >= maxAttempts {
+						status = webhook.StatusDead
+					}
+				}
+
+				logIfErr(logger, wrap(urlRepo.RecordAttempt(ctx, attempt, status, nextAttemptAt))...)
+			}(hook, delivery)
+		}
+
+		wg.Wait()
+	}
+}
+
+// purgeDeliveries deletes the deliveries finished for longer than the retention
+func purgeDeliveries(logger echo.Logger, retention time.Duration) func(context.Context) {
+	return func(ctx context.Context) {
+		logIfErr(logger, urlRepo.PurgeFinishedDeliveries(ctx, time.Now().Add(-retention)))
+	}
+}
+
+// sweepBuckets deletes the rate limit buckets idle for longer than idle, which are full anyway
+func sweepBuckets(logger echo.Logger, store ratelimit.Store, idle time.Duration) func(context.Context) {
+	return func(ctx context.Context) {
+		logIfErr(logger, store.SweepBuckets(ctx, idle))
+	}
+}
+
+// logDroppedHits logs the number of hits dropped since the last run, if any
+func logDroppedHits(logger echo.Logger) func(context.Context) {
+	return func(ctx context.Context) {
+		if dropped := droppedHits.Swap(0); dropped > 0 {
+			logger.Warnf("hit queue was full, dropped %d hits", dropped)
+		}
+	}
+}
+
+// schedule runs the job every interval until the context is done
+func schedule(ctx context.Context, interval time.Duration, job func(context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			job(ctx)
+		}
+	}
+}
+
+// fetchMetadata stores the destination page metadata of the url if requested, or enabled by default,
+// and returns the updated url
+func fetchMetadata(ctx echo.Context, url model.URL) model.URL {
+	if !queryBool(ctx, "metadata", metadataByDefault) {
+		return url
+	}
+
+	return refreshMetadata(ctx.Request().Context(), ctx.Logger(), url)
+}
+
+func refreshMetadata(ctx context.Context, logger echo.Logger, url model.URL) model.URL {
+	meta, err := urlFetcher.Fetch(ctx, url.Destination())
+	if err != nil {
+		// Metadata is optional, so urls are kept without it
+		logger.Warn(err)
+		return url
+	}
+
+	updated, err := urlRepo.UpdateMetadataByID(ctx, url.ID, meta.Title, meta.Description, meta.Image, meta.Favicon)
+	if err != nil {
+		logger.Error(err)
+		return url
+	}
+
+	return updated
+}
+
+// dedupKey identifies the urls which redirect the same way, that is with the same normalized url and options
+func dedupKey(urlHash string, queryMode string, prefix bool, expand bool) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%t|%t", urlHash, queryMode, prefix, expand)))
+	return hex.EncodeToString(sum[:])
+}
+
+// qrOptions gets the QR code options from the query params
+func qrOptions(ctx echo.Context) (qr.Options, error) {
+	opts := qr.DefaultOptions()
+
+	var err error
+	if size := ctx.QueryParam("size"); size != "" {
+		opts.Size, err = strconv.Atoi(size)
+		if err != nil || opts.Size < 64 || opts.Size > 2048 {
+			return opts, errors.New("invalid size")
+		}
+	}
+	if margin := ctx.QueryParam("margin"); margin != "" {
+		opts.Margin, err = strconv.Atoi(margin)
+		if err != nil || opts.Margin < 0 || opts.Margin > 16 {
+			return opts, errors.New("invalid margin")
+		}
+	}
+	if level := ctx.QueryParam("level"); level != "" {
+		if opts.Level, err = qr.ParseLevel(level); err != nil {
+			return opts, err
+		}
+	}
+	if fg := ctx.QueryParam("fg"); fg != "" {
+		if opts.Foreground, err = qr.ParseColor(fg); err != nil {
+			return opts, err
+		}
+	}
+	if bg := ctx.QueryParam("bg"); bg != "" {
+		if opts.Background, err = qr.ParseColor(bg); err != nil {
+			return opts, err
+		}
+	}
+
+	return opts, nil
+}
+
+// queryBool gets the key query param as a boolean
+func queryBool(ctx echo.Context, key string, def bool) bool {
+	if value, err := strconv.ParseBool(ctx.QueryParam(key)); err == nil {
+		return value
+	}
+	return def
+}
+
+// dateRange gets the optional from and to days of the request, both included
+func dateRange(ctx echo.Context) (*time.Time, *time.Time, error) {
+	var days [2]*time.Time
+	for i, param := range []string{"from", "to"} {
+		value := ctx.QueryParam(param)
+		if value == "" {
+			continue
+		}
+		day, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid %s day", param)
+		}
+		days[i] = &day
+	}
+	return days[0], days[1], nil
+}
+
+// fillDays returns a point for every UTC day of the range, with no hits for the days missing from points.
+// The range is bounded by the creation of the url and today, so open ranges do not reach far from the data.
+func fillDays(points []model.Point, createdAt time.Time, from *time.Time, to *time.Time) []model.Point {
+	day := func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+
+	first, last := day(createdAt.UTC()), day(time.Now().UTC())
+	if from != nil && from.After(first) {
+		first = day(*from)
+	}
+	if to != nil && to.Before(last) {
+		last = day(*to)
+	}
+
+	filled := []model.Point{}
+	for current, i := first, 0; !current.After(last); current = current.AddDate(0, 0, 1) {
+		for i < len(points) && points[i].Time.Before(current) {
+			i++
+		}
+		point := model.Point{Time: current}
+		if i < len(points) && points[i].Time.Equal(current) {
+			point.Hits, point.BotHits = points[i].Hits, points[i].BotHits
+		}
+		filled = append(filled, point)
+	}
+	return filled
+}
+
+// paginate gets the limit and offset query params, bounded to sensible values
+func paginate(ctx echo.Context) (int, int) {
+	limit, err := strconv.Atoi(ctx.QueryParam("limit"))
+	if err != nil || limit < 1 || limit > 1000 {
+		limit = 100
+	}
+
+	offset, err := strconv.Atoi(ctx.QueryParam("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	return limit, offset
 }
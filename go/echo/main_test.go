@@ -0,0 +1,102 @@
+package main
+
+import (
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"shortr/qr"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/skip2/go-qrcode"
+)
+
+func TestRoutesStatic(t *testing.T) {
+	static := t.TempDir()
+	assets := map[string]string{
+		"index.html":      "<html></html>",
+		"styles/main.css": "body {}",
+		"scripts/app.js":  "main()",
+		"images/logo.svg": "<svg></svg>",
+	}
+	for path, content := range assets {
+		path = filepath.Join(static, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	none := func(next echo.HandlerFunc) echo.HandlerFunc { return next }
+	app := echo.New()
+	routes(app, static, none, none, none, none)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/", assets["index.html"]},
+		{"/styles/main.css", assets["styles/main.css"]},
+		{"/scripts/app.js", assets["scripts/app.js"]},
+		{"/images/logo.svg", assets["images/logo.svg"]},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != test.want {
+			t.Errorf("GET %s = %d %q, want %d %q", test.path, rec.Code, rec.Body.String(), http.StatusOK, test.want)
+		}
+	}
+
+	for _, dir := range staticDirs {
+		if !reservedNames[dir] {
+			t.Errorf("Name of the static directory %q is not reserved", dir)
+		}
+	}
+}
+
+func TestQROptions(t *testing.T) {
+	defaults := qr.DefaultOptions()
+	custom := defaults
+	custom.Size, custom.Margin, custom.Level = 1024, 0, qrcode.Highest
+	custom.Foreground = color.RGBA{R: 0x11, G: 0x22, B: 0x33, A: 0xff}
+	custom.Background = color.RGBA{R: 0xff, G: 0xee, B: 0xdd, A: 0xff}
+	smallest := defaults
+	smallest.Size = 64
+
+	tests := []struct {
+		query string
+		want  qr.Options
+		fail  bool
+	}{
+		{"", defaults, false},
+		{"size=1024&margin=0&level=H&fg=112233&bg=%23ffeedd", custom, false},
+		{"size=64", smallest, false},
+		{"size=63", qr.Options{}, true},
+		{"size=2049", qr.Options{}, true},
+		{"size=big", qr.Options{}, true},
+		{"margin=-1", qr.Options{}, true},
+		{"margin=17", qr.Options{}, true},
+		{"level=X", qr.Options{}, true},
+		{"fg=fff", qr.Options{}, true},
+		{"bg=zzzzzz", qr.Options{}, true},
+	}
+
+	app := echo.New()
+	for _, test := range tests {
+		ctx := app.NewContext(httptest.NewRequest(http.MethodGet, "/promo/qr?"+test.query, nil), httptest.NewRecorder())
+		opts, err := qrOptions(ctx)
+		if (err != nil) != test.fail {
+			t.Errorf("qrOptions(%q) error = %v, want failure %v", test.query, err, test.fail)
+			continue
+		}
+		if !test.fail && opts != test.want {
+			t.Errorf("qrOptions(%q) = %+v, want %+v", test.query, opts, test.want)
+		}
+	}
+}
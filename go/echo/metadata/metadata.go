@@ -0,0 +1,161 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	nurl "net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var ErrNotHTML = errors.New("destination is not an html page")
+
+// Metadata describes the labels of a destination page
+type Metadata struct {
+	Title       *string
+	Description *string
+	Image       *string
+	Favicon     *string
+}
+
+// Fetcher retrieves the Metadata of destination pages
+type Fetcher struct {
+	client   *http.Client
+	maxBytes int64
+}
+
+// New creates a new Fetcher instance, which reads at most maxBytes of each page
+func New(client *http.Client, maxBytes int64) *Fetcher {
+	return &Fetcher{
+		client:   client,
+		maxBytes: maxBytes,
+	}
+}
+
+// Fetch retrieves the page and extracts its title, description, Open Graph image and favicon
+func (f *Fetcher) Fetch(ctx context.Context, url string) (Metadata, error) {
+	var metadata Metadata
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return metadata, err
+	}
+	req.Header.Set("User-Agent", "Shortr-Metadata/1.0")
+	req.Header.Set("Accept", "text/html")
+
+	res, err := f.client.Do(req)
+	if err != nil {
+		return metadata, err
+	}
+	defer res.Body.Close()
+
+	mediaType, _, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "text/html" && mediaType != "application/xhtml+xml") {
+		return metadata, ErrNotHTML
+	}
+
+	// Relative urls are resolved against the final url, after redirects
+	base := res.Request.URL
+	metadata = parse(io.LimitReader(res.Body, f.maxBytes), base)
+
+	if metadata.Favicon == nil {
+		favicon := base.ResolveReference(&nurl.URL{Path: "/favicon.ico"}).String()
+		metadata.Favicon = &favicon
+	}
+
+	return metadata, nil
+}
+
+func parse(body io.Reader, base *nurl.URL) Metadata {
+	var metadata Metadata
+	var ogTitle, ogDescription *string
+
+	tokenizer := html.NewTokenizer(body)
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return fallback(metadata, ogTitle, ogDescription)
+		case html.EndTagToken:
+			if name, _ := tokenizer.TagName(); string(name) == "head" {
+				return fallback(metadata, ogTitle, ogDescription)
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			switch token.Data {
+			case "body":
+				return fallback(metadata, ogTitle, ogDescription)
+			case "title":
+				if metadata.Title == nil && tokenizer.Next() == html.TextToken {
+					metadata.Title = clean(string(tokenizer.Text()))
+				}
+			case "meta":
+				key := strings.ToLower(attr(token, "name"))
+				if key == "" {
+					key = strings.ToLower(attr(token, "property"))
+				}
+				content := attr(token, "content")
+				switch key {
+				case "description":
+					metadata.Description = clean(content)
+				case "og:title":
+					ogTitle = clean(content)
+				case "og:description":
+					ogDescription = clean(content)
+				case "og:image", "og:image:url":
+					if metadata.Image == nil {
+						metadata.Image = resolve(base, content)
+					}
+				}
+			case "link":
+				for _, rel := range strings.Fields(strings.ToLower(attr(token, "rel"))) {
+					if rel == "icon" && metadata.Favicon == nil {
+						metadata.Favicon = resolve(base, attr(token, "href"))
+					}
+				}
+			}
+		}
+	}
+}
+
+func fallback(metadata Metadata, ogTitle *string, ogDescription *string) Metadata {
+	if metadata.Title == nil {
+		metadata.Title = ogTitle
+	}
+	if metadata.Description == nil {
+		metadata.Description = ogDescription
+	}
+	return metadata
+}
+
+func attr(token html.Token, key string) string {
+	for _, attribute := range token.Attr {
+		if attribute.Key == key {
+			return attribute.Val
+		}
+	}
+	return ""
+}
+
+func clean(value string) *string {
+	value = strings.Join(strings.Fields(value), " ")
+	if value == "" {
+		return nil
+	}
+	if runes := []rune(value); len(runes) > 500 {
+		value = string(runes[:500])
+	}
+	return &value
+}
+
+func resolve(base *nurl.URL, ref string) *string {
+	purl, err := base.Parse(strings.TrimSpace(ref))
+	if err != nil || ref == "" || (purl.Scheme != "http" && purl.Scheme != "https") {
+		return nil
+	}
+	url := purl.String()
+	return &url
+}
@@ -0,0 +1,95 @@
+package metadata
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	nurl "net/url"
+	"strings"
+	"testing"
+)
+
+func value(pointer *string) string {
+	if pointer == nil {
+		return "<nil>"
+	}
+	return *pointer
+}
+
+func TestParse(t *testing.T) {
+	base, _ := nurl.Parse("https://example.com/blog/post")
+
+	tests := []struct {
+		name        string
+		document    string
+		title       string
+		description string
+		image       string
+		favicon     string
+	}{
+		{"empty", "", "<nil>", "<nil>", "<nil>", "<nil>"},
+		{"not html", `{"title": "json"}`, "<nil>", "<nil>", "<nil>", "<nil>"},
+		{"full", `<html><head><title> My
+			Post </title><meta name="Description" content="A  post"><meta property="og:image" content="/cover.png">
+			<link rel="shortcut icon" href="https://cdn.example.com/icon.png"></head></html>`,
+			"My Post", "A post", "https://example.com/cover.png", "https://cdn.example.com/icon.png"},
+		{"open graph fallback", `<head><meta property="og:title" content="OG title"><meta property="og:description" content="OG description"></head>`,
+			"OG title", "OG description", "<nil>", "<nil>"},
+		{"title over open graph", `<head><meta property="og:title" content="OG title"><title>Title</title></head>`,
+			"Title", "<nil>", "<nil>", "<nil>"},
+		{"first title", `<head><title>First</title><title>Second</title></head>`, "First", "<nil>", "<nil>", "<nil>"},
+		{"blank values", `<head><title>   </title><meta name="description" content=""></head>`, "<nil>", "<nil>", "<nil>", "<nil>"},
+		{"relative icon", `<head><link rel="icon" href="icon.svg"></head>`, "<nil>", "<nil>", "<nil>", "https://example.com/blog/icon.svg"},
+		{"unsafe urls", `<head><meta property="og:image" content="javascript:alert(1)"><link rel="icon" href="data:image/png;base64,AA"></head>`,
+			"<nil>", "<nil>", "<nil>", "<nil>"},
+		{"body ignored", `<head></head><body><title>Body title</title></body>`, "<nil>", "<nil>", "<nil>", "<nil>"},
+		{"unclosed head", `<head><title>Cut`, "Cut", "<nil>", "<nil>", "<nil>"},
+		{"long title", "<title>" + strings.Repeat("a", 600) + "</title>", strings.Repeat("a", 500), "<nil>", "<nil>", "<nil>"},
+	}
+
+	for _, test := range tests {
+		metadata := parse(strings.NewReader(test.document), base)
+		if value(metadata.Title) != test.title || value(metadata.Description) != test.description ||
+			value(metadata.Image) != test.image || value(metadata.Favicon) != test.favicon {
+			t.Errorf("parse of %s = %q, %q, %q, %q, want %q, %q, %q, %q", test.name,
+				value(metadata.Title), value(metadata.Description), value(metadata.Image), value(metadata.Favicon),
+				test.title, test.description, test.image, test.favicon)
+		}
+	}
+}
+
+func TestFetch(t *testing.T) {
+	tests := []struct {
+		contentType string
+		body        string
+		title       string
+		favicon     string
+		err         error
+	}{
+		{"text/html; charset=utf-8", "<title>Page</title>", "Page", "/favicon.ico", nil},
+		{"application/xhtml+xml", `<title>Page</title><link rel="icon" href="/icon.png">`, "Page", "/icon.png", nil},
+		// Only the first bytes are read, so the title is cut
+		{"text/html", "<title>" + strings.Repeat("a", 100) + "</title>", strings.Repeat("a", 57), "/favicon.ico", nil},
+		{"application/json", `{}`, "<nil>", "<nil>", ErrNotHTML},
+		{"", "<title>Page</title>", "<nil>", "<nil>", ErrNotHTML},
+	}
+
+	for _, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if test.contentType != "" {
+				w.Header().Set("Content-Type", test.contentType)
+			} else {
+				w.Header()["Content-Type"] = nil
+			}
+			w.Write([]byte(test.body))
+		}))
+
+		metadata, err := New(server.Client(), 64).Fetch(context.Background(), server.URL+"/page")
+		favicon := strings.TrimPrefix(value(metadata.Favicon), server.URL)
+		server.Close()
+
+		if err != test.err || value(metadata.Title) != test.title || favicon != test.favicon {
+			t.Errorf("Fetch of %q = %q, %q, %v, want %q, %q, %v", test.contentType, value(metadata.Title), favicon, err, test.title, test.favicon, test.err)
+		}
+	}
+}
@@ -1,16 +1,200 @@
 package model
 
 import (
+	"encoding/json"
 	"time"
 )
 
 // URL describes the URL model
 type URL struct {
-	ID         int        `db:"id" json:"id"`
-	Name       string     `db:"name" json:"name"`
-	URL        string     `db:"url" json:"url"`
-	Hits       int        `db:"hits" json:"hits"`
-	LastHitAt  *time.Time `db:"last_hit_at" json:"last_hit_at"`
-	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
-	ModifiedAt time.Time  `db:"modified_at" json:"modified_at"`
+	ID              int               `db:"id" json:"id"`
+	Name            string            `db:"name" json:"name"`
+	URL             string            `db:"url" json:"url"`
+	Hits            int               `db:"hits" json:"hits"`
+	LastHitAt       *time.Time        `db:"last_hit_at" json:"last_hit_at"`
+	CreatedAt       time.Time         `db:"created_at" json:"created_at"`
+	ModifiedAt      time.Time         `db:"modified_at" json:"modified_at"`
+	ExpandedURL     *string           `db:"expanded_url" json:"expanded_url"`
+	CheckStatus     *string           `db:"check_status" json:"check_status"`
+	CheckCode       *int              `db:"check_code" json:"check_code"`
+	CheckedAt       *time.Time        `db:"checked_at" json:"checked_at"`
+	CheckFailures   int               `db:"check_failures" json:"check_failures"`
+	MetaTitle       *string           `db:"meta_title" json:"meta_title"`
+	MetaDescription *string           `db:"meta_description" json:"meta_description"`
+	MetaImage       *string           `db:"meta_image" json:"meta_image"`
+	MetaFavicon     *string           `db:"meta_favicon" json:"meta_favicon"`
+	QueryMode       string            `db:"query_mode" json:"query_mode"`
+	Prefix          bool              `db:"prefix" json:"prefix"`
+	Rules           []Rule            `db:"rules" json:"rules"`
+	Platforms       map[string]string `db:"platforms" json:"platforms"`
+	Variants        []Variant         `db:"variants" json:"variants"`
+	StickyVariants  bool              `db:"sticky_variants" json:"sticky_variants"`
+	DeletedAt       *time.Time        `db:"deleted_at" json:"deleted_at"`
+	BotHits         int               `db:"bot_hits" json:"bot_hits"`
+	DedupKey        *string           `db:"dedup_key" json:"-"`
+}
+
+// Rule describes a conditional destination of an URL
+type Rule struct {
+	Countries []string `json:"countries"`
+	Languages []string `json:"languages"`
+	URL       string   `json:"url"`
+}
+
+// Destination returns the url where the URL redirects to
+func (u URL) Destination() string {
+	if u.ExpandedURL != nil {
+		return *u.ExpandedURL
+	}
+	return u.URL
+}
+
+// Variant describes a weighted alternative destination of an URL
+type Variant struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+// Schedule describes a destination change of an URL that takes effect at a given time
+type Schedule struct {
+	ID            int        `db:"id" json:"id"`
+	URLID         int        `db:"url_id" json:"url_id"`
+	URL           string     `db:"url" json:"url"`
+	ExpandedURL   *string    `db:"expanded_url" json:"expanded_url"`
+	EffectiveFrom time.Time  `db:"effective_from" json:"effective_from"`
+	CreatedAt     time.Time  `db:"created_at" json:"created_at"`
+	AppliedAt     *time.Time `db:"applied_at" json:"applied_at"`
+}
+
+// Change describes a destination change of an URL
+type Change struct {
+	ID        int       `db:"id" json:"id"`
+	URLID     int       `db:"url_id" json:"url_id"`
+	OldURL    *string   `db:"old_url" json:"old_url"`
+	NewURL    string    `db:"new_url" json:"new_url"`
+	ChangedAt time.Time `db:"changed_at" json:"changed_at"`
+	Actor     string    `db:"actor" json:"-"`
+}
+
+// AuditEntry describes a mutation made to an URL, chained to the previous entry by its hash
+type AuditEntry struct {
+	ID        int64           `db:"id" json:"id"`
+	Subject   string          `db:"subject" json:"subject"`
+	Action    string          `db:"action" json:"action"`
+	URLID     *int            `db:"url_id" json:"url_id"`
+	Actor     string          `db:"actor" json:"actor"`
+	IP        string          `db:"ip" json:"ip"`
+	UserAgent string          `db:"user_agent" json:"user_agent"`
+	RequestID string          `db:"request_id" json:"request_id"`
+	Before    json.RawMessage `db:"before" json:"before"`
+	After     json.RawMessage `db:"after" json:"after"`
+	CreatedAt time.Time       `db:"created_at" json:"created_at"`
+	PrevHash  string          `db:"prev_hash" json:"prev_hash"`
+	Hash      string          `db:"hash" json:"hash"`
+}
+
+// Verification describes the result of verifying the audit log chain
+type Verification struct {
+	Valid      bool   `json:"valid"`
+	Verified   int    `json:"verified"`
+	TamperedID *int64 `json:"tampered_id"`
+}
+
+// Click describes each redirect of an URL
+type Click struct {
+	ID        int64     `db:"id" json:"id"`
+	URLID     int       `db:"url_id" json:"url_id"`
+	ClickedAt time.Time `db:"clicked_at" json:"clicked_at"`
+	OS        string    `db:"os" json:"os"`
+	Device    string    `db:"device" json:"device"`
+	Variant   *string   `db:"variant" json:"variant"`
+	Bot       bool      `db:"bot" json:"bot"`
+	Referrer  *string   `db:"referrer" json:"referrer"`
+	Source    string    `db:"source" json:"source"`
+	Country   *string   `db:"country" json:"country"`
+	Region    *string   `db:"region" json:"region"`
+	Browser   string    `db:"browser" json:"browser"`
+}
+
+// Stats describes an URL with its analytics
+type Stats struct {
+	URL
+	VariantHits    map[string]int `json:"variant_hits"`
+	Changes        []Change       `json:"changes"`
+	UniqueVisitors uint64         `json:"unique_visitors"`
+	Series         []Point        `json:"series"`
+	HourOfWeek     [7][24]int     `json:"hour_of_week"`
+	Referrers      []Referrer     `json:"referrers"`
+	Sources        map[string]int `json:"sources"`
+	Countries      map[string]int `json:"countries"`
+	Regions        map[string]int `json:"regions"`
+	Browsers       map[string]int `json:"browsers"`
+	Systems        map[string]int `json:"operating_systems"`
+	Devices        map[string]int `json:"devices"`
+}
+
+// Referrer describes the hits of an URL referred by a domain
+type Referrer struct {
+	Domain string `json:"domain"`
+	Source string `json:"source"`
+	Hits   int    `json:"hits"`
+}
+
+// Point describes the hits of an URL in a time interval
+type Point struct {
+	Name    string    `json:"name,omitempty"`
+	Time    time.Time `json:"time"`
+	Hits    int       `json:"hits"`
+	BotHits int       `json:"bot_hits"`
+}
+
+// Preview describes what is shown about an URL before redirecting to it,
+// with the target the visit resolves to and the path and query it continues with
+type Preview struct {
+	URL
+	Target string              `json:"target"`
+	Domain string              `json:"domain"`
+	Safe   bool                `json:"safe"`
+	Reason *string             `json:"reason"`
+	Path   string              `json:"-"`
+	Query  map[string][]string `json:"-"`
+}
+
+// Webhook describes a subscription of an endpoint to URL events
+type Webhook struct {
+	ID        int       `db:"id" json:"id"`
+	URL       string    `db:"url" json:"url"`
+	Secret    string    `db:"secret" json:"secret,omitempty"`
+	Events    []string  `db:"events" json:"events"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// Delivery describes an event queued to be posted to a Webhook
+type Delivery struct {
+	ID            int64           `db:"id" json:"id"`
+	WebhookID     int             `db:"webhook_id" json:"webhook_id"`
+	Event         string          `db:"event" json:"event"`
+	Payload       json.RawMessage `db:"payload" json:"payload"`
+	Status        string          `db:"status" json:"status"`
+	Attempts      int             `db:"attempts" json:"attempts"`
+	NextAttemptAt time.Time       `db:"next_attempt_at" json:"next_attempt_at"`
+	CreatedAt     time.Time       `db:"created_at" json:"created_at"`
+	FinishedAt    *time.Time      `db:"finished_at" json:"finished_at"`
+}
+
+// Attempt describes a try to post a Delivery, its duration in milliseconds
+type Attempt struct {
+	ID          int64     `db:"id" json:"id"`
+	DeliveryID  int64     `db:"delivery_id" json:"delivery_id"`
+	AttemptedAt time.Time `db:"attempted_at" json:"attempted_at"`
+	Code        *int      `db:"code" json:"code"`
+	Error       *string   `db:"error" json:"error"`
+	Duration    int       `db:"duration" json:"duration"`
+}
+
+// DeliveryLog describes a Delivery along with its attempts
+type DeliveryLog struct {
+	Delivery
+	Log []Attempt `json:"log"`
 }
@@ -0,0 +1,52 @@
+package normalizer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	nurl "net/url"
+	"strings"
+)
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// Normalize transforms the url to a canonical form, so equivalent urls are equal
+func Normalize(url string) (string, error) {
+	purl, err := nurl.Parse(strings.TrimSpace(url))
+	if err != nil {
+		return "", err
+	}
+
+	purl.Scheme = strings.ToLower(purl.Scheme)
+
+	host := strings.TrimSuffix(strings.ToLower(purl.Hostname()), ".")
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port := purl.Port(); port != "" && port != defaultPorts[purl.Scheme] {
+		host = host + ":" + port
+	}
+	purl.Host = host
+
+	if purl.Path == "" {
+		purl.Path = "/"
+	}
+
+	// Encode sorts the query params by key
+	purl.RawQuery = purl.Query().Encode()
+
+	return purl.String(), nil
+}
+
+// Hash returns the hex encoded SHA-256 of the normalized url
+func Hash(url string) (string, error) {
+	normalized, err := Normalize(url)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:]), nil
+}
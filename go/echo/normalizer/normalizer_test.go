@@ -0,0 +1,73 @@
+package normalizer
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://example.com", "https://example.com/"},
+		{"  https://example.com/path  ", "https://example.com/path"},
+		{"HTTPS://Example.COM/Path", "https://example.com/Path"},
+		{"https://example.com./", "https://example.com/"},
+		{"https://example.com:443/", "https://example.com/"},
+		{"http://example.com:80/", "http://example.com/"},
+		{"https://example.com:8443/", "https://example.com:8443/"},
+		{"http://example.com:443/", "http://example.com:443/"},
+		{"https://example.com/?b=2&a=1", "https://example.com/?a=1&b=2"},
+		{"https://example.com/?a=2&a=1", "https://example.com/?a=2&a=1"},
+		{"https://example.com/#section", "https://example.com/#section"},
+		{"https://app.example.com#/a", "https://app.example.com/#/a"},
+		{"https://[::1]:443/", "https://[::1]/"},
+		{"https://[::1]:8080/", "https://[::1]:8080/"},
+	}
+
+	for _, test := range tests {
+		got, err := Normalize(test.url)
+		if err != nil {
+			t.Errorf("Normalize(%q) error = %v", test.url, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("Normalize(%q) = %q, want %q", test.url, got, test.want)
+		}
+	}
+}
+
+func TestNormalizeMalformed(t *testing.T) {
+	if _, err := Normalize("https://example.com/%zz"); err == nil {
+		t.Error("Normalize of a malformed url succeeded")
+	}
+}
+
+func TestHash(t *testing.T) {
+	tests := []struct {
+		a     string
+		b     string
+		equal bool
+	}{
+		{"https://example.com", "HTTPS://EXAMPLE.COM:443/", true},
+		{"https://app.example.com/#/a", "https://app.example.com/#/b", false},
+		{"https://example.com/?a=1&b=2", "https://example.com/?b=2&a=1", true},
+		{"https://example.com/a", "https://example.com/A", false},
+		{"http://example.com", "https://example.com", false},
+	}
+
+	for _, test := range tests {
+		a, err := Hash(test.a)
+		if err != nil {
+			t.Fatalf("Hash(%q) error = %v", test.a, err)
+		}
+		b, err := Hash(test.b)
+		if err != nil {
+			t.Fatalf("Hash(%q) error = %v", test.b, err)
+		}
+		if len(a) != 64 {
+			t.Errorf("Hash(%q) has length %d, want 64", test.a, len(a))
+		}
+		if (a == b) != test.equal {
+			t.Errorf("Hash(%q) == Hash(%q) is %v, want %v", test.a, test.b, a == b, test.equal)
+		}
+	}
+}
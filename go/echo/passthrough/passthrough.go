@@ -0,0 +1,83 @@
+package passthrough
+
+import (
+	"errors"
+	nurl "net/url"
+	"strings"
+)
+
+const (
+	ModeDrop     = "drop"     // The incoming query is ignored
+	ModeAppend   = "append"   // The incoming query is appended to the destination query
+	ModeOverride = "override" // The incoming params replace the destination params with the same key
+	ModePreserve = "preserve" // The incoming params are added unless the destination has the same key
+)
+
+var ErrInvalidMode = errors.New("invalid query passthrough mode")
+var ErrInvalidPath = errors.New("invalid forwarded path")
+
+// Valid reports whether the mode is a known passthrough mode
+func Valid(mode string) bool {
+	switch mode {
+	case ModeDrop, ModeAppend, ModeOverride, ModePreserve:
+		return true
+	default:
+		return false
+	}
+}
+
+// Apply passes the incoming query to the destination url according to the mode
+func Apply(destination string, mode string, incoming nurl.Values) (string, error) {
+	if mode == ModeDrop || len(incoming) == 0 {
+		return destination, nil
+	}
+
+	purl, err := nurl.Parse(destination)
+	if err != nil {
+		return "", err
+	}
+
+	switch mode {
+	case ModeAppend:
+		if purl.RawQuery == "" {
+			purl.RawQuery = incoming.Encode()
+		} else {
+			purl.RawQuery = purl.RawQuery + "&" + incoming.Encode()
+		}
+	case ModeOverride, ModePreserve:
+		query := purl.Query()
+		for key, values := range incoming {
+			if _, exists := query[key]; exists && mode == ModePreserve {
+				continue
+			}
+			query[key] = values
+		}
+		purl.RawQuery = query.Encode()
+	default:
+		return "", ErrInvalidMode
+	}
+
+	return purl.String(), nil
+}
+
+// Forward appends the unescaped path segments to the destination url path.
+// Parent segments are rejected, so the forwarded path never leaves the destination path.
+func Forward(destination string, path string) (string, error) {
+	if path == "" {
+		return destination, nil
+	}
+
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for _, segment := range segments {
+		if segment == ".." || segment == "." {
+			return "", ErrInvalidPath
+		}
+	}
+
+	purl, err := nurl.Parse(destination)
+	if err != nil {
+		return "", err
+	}
+
+	return purl.JoinPath(segments...).String(), nil
+}
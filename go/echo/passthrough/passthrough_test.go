@@ -0,0 +1,86 @@
+package passthrough
+
+import (
+	nurl "net/url"
+	"testing"
+)
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		mode string
+		want bool
+	}{
+		{ModeDrop, true},
+		{ModeAppend, true},
+		{ModeOverride, true},
+		{ModePreserve, true},
+		{"", false},
+		{"DROP", false},
+		{"merge", false},
+	}
+
+	for _, test := range tests {
+		if got := Valid(test.mode); got != test.want {
+			t.Errorf("Valid(%q) = %v, want %v", test.mode, got, test.want)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		destination string
+		mode        string
+		incoming    string
+		want        string
+		err         error
+	}{
+		{"https://example.com/?a=1", ModeDrop, "a=2&b=3", "https://example.com/?a=1", nil},
+		{"https://example.com/?a=1", ModeAppend, "", "https://example.com/?a=1", nil},
+		{"https://example.com/", ModeAppend, "b=3", "https://example.com/?b=3", nil},
+		{"https://example.com/?a=1", ModeAppend, "a=2", "https://example.com/?a=1&a=2", nil},
+		{"https://example.com/?a=1&c=4", ModeOverride, "a=2&b=3", "https://example.com/?a=2&b=3&c=4", nil},
+		{"https://example.com/?a=1&c=4", ModePreserve, "a=2&b=3", "https://example.com/?a=1&b=3&c=4", nil},
+		{"https://example.com/#top", ModeAppend, "b=3", "https://example.com/?b=3#top", nil},
+		{"https://example.com/", "merge", "b=3", "", ErrInvalidMode},
+	}
+
+	for _, test := range tests {
+		incoming, _ := nurl.ParseQuery(test.incoming)
+		got, err := Apply(test.destination, test.mode, incoming)
+		if err != test.err {
+			t.Errorf("Apply(%q, %q, %q) error = %v, want %v", test.destination, test.mode, test.incoming, err, test.err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("Apply(%q, %q, %q) = %q, want %q", test.destination, test.mode, test.incoming, got, test.want)
+		}
+	}
+}
+
+func TestForward(t *testing.T) {
+	tests := []struct {
+		destination string
+		path        string
+		want        string
+		err         error
+	}{
+		{"https://docs.example.com", "", "https://docs.example.com", nil},
+		{"https://docs.example.com", "getting-started", "https://docs.example.com/getting-started", nil},
+		{"https://docs.example.com/v1/", "guides/install", "https://docs.example.com/v1/guides/install", nil},
+		{"https://docs.example.com/v1?lang=en", "/guides/", "https://docs.example.com/v1/guides?lang=en", nil},
+		{"https://docs.example.com/v1", "a b", "https://docs.example.com/v1/a%20b", nil},
+		{"https://docs.example.com/v1", "../admin", "", ErrInvalidPath},
+		{"https://docs.example.com/v1", "guides/./install", "", ErrInvalidPath},
+	}
+
+	for _, test := range tests {
+		got, err := Forward(test.destination, test.path)
+		if err != test.err {
+			t.Errorf("Forward(%q, %q) error = %v, want %v", test.destination, test.path, err, test.err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("Forward(%q, %q) = %q, want %q", test.destination, test.path, got, test.want)
+		}
+	}
+}
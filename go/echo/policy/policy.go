@@ -0,0 +1,230 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	nurl "net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var ErrMalformed = errors.New("destination url is malformed")
+var ErrTooLong = errors.New("destination url is too long")
+var ErrSchemeNotAllowed = errors.New("destination url scheme is not allowed")
+var ErrDomainDenied = errors.New("destination url domain is denied")
+var ErrDomainNotAllowed = errors.New("destination url domain is not allowed")
+var ErrSelfReference = errors.New("destination url points back to this service")
+var ErrPrivateAddress = errors.New("destination url points to a private or loopback address")
+
+// Policy describes the rules a destination url must satisfy
+type Policy struct {
+	schemes      []string
+	allow        []string
+	deny         []string
+	self         []string
+	blockPrivate bool
+	maxLength    int
+}
+
+// New creates a new Policy instance.
+// Domain patterns match exactly or, when prefixed with "*.", any of their subdomains.
+// An empty allow list allows every domain that is not denied. The self hosts match along with their subdomains, on any port.
+func New(schemes []string, allow []string, deny []string, self []string, blockPrivate bool, maxLength int) *Policy {
+	return &Policy{
+		schemes:      normalize(schemes),
+		allow:        normalize(allow),
+		deny:         normalize(deny),
+		self:         normalizeHosts(self),
+		blockPrivate: blockPrivate,
+		maxLength:    maxLength,
+	}
+}
+
+// Check validates the destination url against the Policy and returns the reason of the rejection, if any
+func (p *Policy) Check(ctx context.Context, url string) error {
+	if p.maxLength > 0 && len(url) > p.maxLength {
+		return ErrTooLong
+	}
+
+	purl, err := nurl.ParseRequestURI(url)
+	if err != nil {
+		return ErrMalformed
+	}
+
+	if !contains(p.schemes, strings.ToLower(purl.Scheme)) {
+		return ErrSchemeNotAllowed
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(purl.Hostname()), ".")
+	if host == "" {
+		return ErrMalformed
+	}
+
+	if p.isSelf(host) {
+		return ErrSelfReference
+	}
+
+	if matches(p.deny, host) {
+		return ErrDomainDenied
+	}
+
+	if len(p.allow) > 0 && !matches(p.allow, host) {
+		return ErrDomainNotAllowed
+	}
+
+	if p.blockPrivate {
+		if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+			return ErrPrivateAddress
+		}
+
+		if ip := net.ParseIP(host); ip != nil {
+			if isPrivate(ip) {
+				return ErrPrivateAddress
+			}
+			return nil
+		}
+
+		// Unresolvable hosts are allowed, they may exist in the future
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil
+		}
+		for _, addr := range addrs {
+			if isPrivate(addr.IP) {
+				return ErrPrivateAddress
+			}
+		}
+	}
+
+	return nil
+}
+
+// CheckIntent validates the Android intent url, whose browser fallback url, if any, must satisfy the Policy.
+// Intents only open apps, so their scheme and host are not checked.
+func (p *Policy) CheckIntent(ctx context.Context, url string) error {
+	if p.maxLength > 0 && len(url) > p.maxLength {
+		return ErrTooLong
+	}
+
+	// Intents look like intent://path#Intent;scheme=https;package=com.example;S.browser_fallback_url=...;end
+	hash := strings.Index(url, "#Intent;")
+	if !strings.HasPrefix(strings.ToLower(url), "intent:") || hash < 0 || !strings.HasSuffix(url, ";end") {
+		return ErrMalformed
+	}
+
+	for _, extra := range strings.Split(url[hash+len("#Intent;"):], ";") {
+		if strings.HasPrefix(extra, "S.browser_fallback_url=") {
+			unescaped, err := nurl.QueryUnescape(strings.TrimPrefix(extra, "S.browser_fallback_url="))
+			if err != nil {
+				return ErrMalformed
+			}
+			return p.Check(ctx, unescaped)
+		}
+	}
+
+	return nil
+}
+
+// Transport creates a new http.Transport which, when private addresses are blocked, refuses to connect to them.
+// Addresses are checked once resolved, right before connecting, so hosts resolving differently than when
+// they were checked cannot reach private addresses either. Proxies are not used, as they would be checked instead.
+func (p *Policy) Transport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !p.blockPrivate {
+		return transport
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   control,
+	}
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
+
+// IsViolation reports whether the error is one of the Policy rejection reasons
+func IsViolation(err error) bool {
+	switch err {
+	case ErrMalformed, ErrTooLong, ErrSchemeNotAllowed, ErrDomainDenied,
+		ErrDomainNotAllowed, ErrSelfReference, ErrPrivateAddress:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *Policy) isSelf(host string) bool {
+	for _, self := range p.self {
+		if host == self || strings.HasSuffix(host, "."+self) {
+			return true
+		}
+	}
+	return false
+}
+
+func control(network string, address string, conn syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || isPrivate(ip) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+func isPrivate(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast()
+}
+
+func matches(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "*.") {
+			if strings.HasSuffix(host, pattern[1:]) {
+				return true
+			}
+			continue
+		}
+		if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func normalize(values []string) []string {
+	normalized := make([]string, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(value)), ".")
+		if value != "" {
+			normalized = append(normalized, value)
+		}
+	}
+	return normalized
+}
+
+func normalizeHosts(values []string) []string {
+	hosts := normalize(values)
+	for i, host := range hosts {
+		if name, _, err := net.SplitHostPort(host); err == nil {
+			host = name
+		}
+		hosts[i] = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+	}
+	return hosts
+}
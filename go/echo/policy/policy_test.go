@@ -0,0 +1,149 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	policy := New(
+		[]string{"http", "https"},
+		[]string{},
+		[]string{"denied.com", "*.evil.com"},
+		[]string{"short.io:8080", "Self.Example."},
+		true,
+		100,
+	)
+
+	tests := []struct {
+		url string
+		err error
+	}{
+		{"https://example.com/path?query", nil},
+		{"HTTPS://example.com", nil},
+		{"https://" + strings.Repeat("a", 100) + ".com", ErrTooLong},
+		{"not a url", ErrMalformed},
+		{"https://", ErrMalformed},
+		{"ftp://example.com", ErrSchemeNotAllowed},
+		{"javascript:alert(1)", ErrSchemeNotAllowed},
+		{"https://denied.com", ErrDomainDenied},
+		{"https://sub.denied.com", nil},
+		{"https://www.evil.com", ErrDomainDenied},
+		{"https://short.io/abc", ErrSelfReference},
+		{"https://short.io:443/abc", ErrSelfReference},
+		{"https://SHORT.IO./abc", ErrSelfReference},
+		{"https://www.short.io/abc", ErrSelfReference},
+		{"https://self.example/abc", ErrSelfReference},
+		{"https://notshort.io/abc", nil},
+		{"http://localhost/admin", ErrPrivateAddress},
+		{"http://api.localhost", ErrPrivateAddress},
+		{"http://127.0.0.1:8080", ErrPrivateAddress},
+		{"http://10.0.0.1", ErrPrivateAddress},
+		{"http://169.254.169.254/latest/meta-data", ErrPrivateAddress},
+		{"http://[::1]/", ErrPrivateAddress},
+		{"http://0.0.0.0", ErrPrivateAddress},
+		{"http://93.184.216.34", nil},
+	}
+
+	for _, test := range tests {
+		if err := policy.Check(context.Background(), test.url); err != test.err {
+			t.Errorf("Check(%q) = %v, want %v", test.url, err, test.err)
+		}
+	}
+}
+
+func TestCheckAllowList(t *testing.T) {
+	policy := New([]string{"https"}, []string{"example.com", "*.trusted.org"}, nil, nil, false, 0)
+
+	tests := []struct {
+		url string
+		err error
+	}{
+		{"https://example.com", nil},
+		{"https://www.example.com", ErrDomainNotAllowed},
+		{"https://docs.trusted.org", nil},
+		{"https://trusted.org", ErrDomainNotAllowed},
+		{"https://other.com", ErrDomainNotAllowed},
+		{"http://example.com", ErrSchemeNotAllowed},
+		{"https://127.0.0.1", ErrDomainNotAllowed},
+	}
+
+	for _, test := range tests {
+		if err := policy.Check(context.Background(), test.url); err != test.err {
+			t.Errorf("Check(%q) = %v, want %v", test.url, err, test.err)
+		}
+	}
+}
+
+func TestCheckIntent(t *testing.T) {
+	policy := New([]string{"https"}, nil, []string{"denied.com"}, nil, true, 200)
+
+	tests := []struct {
+		url string
+		err error
+	}{
+		{"intent://scan/#Intent;scheme=zxing;package=com.google.zxing.client.android;end", nil},
+		{"intent:#Intent;action=android.intent.action.VIEW;package=com.example;end", nil},
+		{"intent://path#Intent;package=com.example;S.browser_fallback_url=https%3A%2F%2Fexample.com%2Fapp;end", nil},
+		{"intent://path#Intent;package=com.example;S.browser_fallback_url=https%3A%2F%2Fdenied.com;end", ErrDomainDenied},
+		{"intent://path#Intent;package=com.example;S.browser_fallback_url=http%3A%2F%2F127.0.0.1;end", ErrSchemeNotAllowed},
+		{"intent://path#Intent;package=com.example;S.browser_fallback_url=%zz;end", ErrMalformed},
+		{"intent://path#Intent;package=com.example", ErrMalformed},
+		{"intent://path;end", ErrMalformed},
+		{"https://example.com/#Intent;end", ErrMalformed},
+		{"intent://" + strings.Repeat("a", 200) + "#Intent;end", ErrTooLong},
+	}
+
+	for _, test := range tests {
+		if err := policy.CheckIntent(context.Background(), test.url); err != test.err {
+			t.Errorf("CheckIntent(%q) = %v, want %v", test.url, err, test.err)
+		}
+	}
+}
+
+func TestIsViolation(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{ErrMalformed, true},
+		{ErrPrivateAddress, true},
+		{ErrSelfReference, true},
+		{context.Canceled, false},
+		{nil, false},
+	}
+
+	for _, test := range tests {
+		if got := IsViolation(test.err); got != test.want {
+			t.Errorf("IsViolation(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
+
+func TestTransport(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	tests := []struct {
+		blockPrivate bool
+		err          error
+	}{
+		{true, ErrPrivateAddress},
+		{false, nil},
+	}
+
+	for _, test := range tests {
+		client := &http.Client{Transport: New(nil, nil, nil, nil, test.blockPrivate, 0).Transport()}
+		res, err := client.Get(server.URL)
+		if err == nil {
+			res.Body.Close()
+		}
+		if !errors.Is(err, test.err) {
+			t.Errorf("Get with blockPrivate %v error = %v, want %v", test.blockPrivate, err, test.err)
+		}
+	}
+}
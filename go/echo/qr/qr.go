@@ -0,0 +1,166 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+var ErrInvalidLevel = errors.New("invalid error correction level")
+var ErrInvalidColor = errors.New("invalid color")
+
+var levels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+// Options describes how a QR code is rendered
+type Options struct {
+	Size       int // Maximum width and height in pixels
+	Level      qrcode.RecoveryLevel
+	Margin     int // Quiet zone width in modules
+	Foreground color.RGBA
+	Background color.RGBA
+}
+
+// DefaultOptions returns the Options of a black on white QR code with medium error correction
+func DefaultOptions() Options {
+	return Options{
+		Size:       256,
+		Level:      qrcode.Medium,
+		Margin:     4,
+		Foreground: color.RGBA{A: 0xff},
+		Background: color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+	}
+}
+
+// ParseLevel gets the error correction level from its name (L, M, Q or H)
+func ParseLevel(level string) (qrcode.RecoveryLevel, error) {
+	if value, exists := levels[strings.ToUpper(level)]; exists {
+		return value, nil
+	}
+	return qrcode.Medium, ErrInvalidLevel
+}
+
+// ParseColor gets the color from its hex representation (RRGGBB), with or without leading #
+func ParseColor(hex string) (color.RGBA, error) {
+	hex = strings.TrimPrefix(hex, "#")
+	if len(hex) != 6 {
+		return color.RGBA{}, ErrInvalidColor
+	}
+
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, ErrInvalidColor
+	}
+
+	return color.RGBA{R: uint8(value >> 16), G: uint8(value >> 8), B: uint8(value), A: 0xff}, nil
+}
+
+// PNG renders the content as a QR code PNG image
+func PNG(content string, opts Options) ([]byte, error) {
+	bitmap, err := bitmap(content, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	modules := len(bitmap)
+	scale := scaleOf(modules, opts.Size)
+
+	palette := color.Palette{opts.Background, opts.Foreground}
+	img := image.NewPaletted(image.Rect(0, 0, modules*scale, modules*scale), palette)
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetColorIndex(x*scale+dx, y*scale+dy, 1)
+				}
+			}
+		}
+	}
+
+	var buffer bytes.Buffer
+	err = png.Encode(&buffer, img)
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// SVG renders the content as a QR code SVG image
+func SVG(content string, opts Options) ([]byte, error) {
+	bitmap, err := bitmap(content, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	modules := len(bitmap)
+	size := modules * scaleOf(modules, opts.Size)
+
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		size, size, modules, modules)
+	fmt.Fprintf(&buffer, `<rect width="%d" height="%d" fill="%s"/>`, modules, modules, hexOf(opts.Background))
+	fmt.Fprintf(&buffer, `<path fill="%s" d="`, hexOf(opts.Foreground))
+	for y, row := range bitmap {
+		// Consecutive dark modules are drawn as a single rectangle
+		for x := 0; x < modules; x++ {
+			if !row[x] {
+				continue
+			}
+			start := x
+			for x < modules && row[x] {
+				x++
+			}
+			fmt.Fprintf(&buffer, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+		}
+	}
+	buffer.WriteString(`"/></svg>`)
+
+	return buffer.Bytes(), nil
+}
+
+func bitmap(content string, opts Options) ([][]bool, error) {
+	code, err := qrcode.New(content, opts.Level)
+	if err != nil {
+		return nil, err
+	}
+	code.DisableBorder = true
+
+	symbol := code.Bitmap()
+	modules := len(symbol) + 2*opts.Margin
+
+	bitmap := make([][]bool, modules)
+	for y := range bitmap {
+		bitmap[y] = make([]bool, modules)
+	}
+	for y, row := range symbol {
+		copy(bitmap[y+opts.Margin][opts.Margin:], row)
+	}
+
+	return bitmap, nil
+}
+
+func scaleOf(modules int, size int) int {
+	if scale := size / modules; scale > 1 {
+		return scale
+	}
+	return 1
+}
+
+func hexOf(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
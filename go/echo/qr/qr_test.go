@@ -0,0 +1,107 @@
+package qr
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/skip2/go-qrcode"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		level string
+		want  qrcode.RecoveryLevel
+		err   error
+	}{
+		{"L", qrcode.Low, nil},
+		{"m", qrcode.Medium, nil},
+		{"Q", qrcode.High, nil},
+		{"h", qrcode.Highest, nil},
+		{"", qrcode.Medium, ErrInvalidLevel},
+		{"X", qrcode.Medium, ErrInvalidLevel},
+		{"high", qrcode.Medium, ErrInvalidLevel},
+	}
+
+	for _, test := range tests {
+		got, err := ParseLevel(test.level)
+		if got != test.want || err != test.err {
+			t.Errorf("ParseLevel(%q) = %v, %v, want %v, %v", test.level, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		hex  string
+		want color.RGBA
+		err  error
+	}{
+		{"000000", color.RGBA{A: 0xff}, nil},
+		{"#ff8000", color.RGBA{R: 0xff, G: 0x80, A: 0xff}, nil},
+		{"1A2b3C", color.RGBA{R: 0x1a, G: 0x2b, B: 0x3c, A: 0xff}, nil},
+		{"", color.RGBA{}, ErrInvalidColor},
+		{"#fff", color.RGBA{}, ErrInvalidColor},
+		{"ff80000", color.RGBA{}, ErrInvalidColor},
+		{"gggggg", color.RGBA{}, ErrInvalidColor},
+		{"0x1234", color.RGBA{}, ErrInvalidColor},
+		{"+12345", color.RGBA{}, ErrInvalidColor},
+	}
+
+	for _, test := range tests {
+		got, err := ParseColor(test.hex)
+		if got != test.want || err != test.err {
+			t.Errorf("ParseColor(%q) = %v, %v, want %v, %v", test.hex, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestPNG(t *testing.T) {
+	tests := []struct {
+		size   int
+		margin int
+		width  int
+	}{
+		// Version 1 codes have 21 modules, scaled by the largest integer that fits the size
+		{256, 4, 29 * 8},
+		{256, 0, 21 * 12},
+		{10, 4, 29},
+	}
+
+	for _, test := range tests {
+		opts := DefaultOptions()
+		opts.Size, opts.Margin, opts.Level = test.size, test.margin, qrcode.Low
+		image, err := PNG("abc", opts)
+		if err != nil {
+			t.Fatalf("PNG of size %d error = %v", test.size, err)
+		}
+		decoded, err := png.Decode(bytes.NewReader(image))
+		if err != nil {
+			t.Fatalf("PNG of size %d is not a PNG: %v", test.size, err)
+		}
+		if width := decoded.Bounds().Dx(); width != test.width || decoded.Bounds().Dy() != test.width {
+			t.Errorf("PNG of size %d and margin %d is %dx%d, want %dx%d", test.size, test.margin, width, decoded.Bounds().Dy(), test.width, test.width)
+		}
+	}
+}
+
+func TestSVG(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Level = qrcode.Low
+	opts.Foreground, _ = ParseColor("112233")
+	opts.Background, _ = ParseColor("ffeedd")
+
+	image, err := SVG("abc", opts)
+	if err != nil {
+		t.Fatalf("SVG error = %v", err)
+	}
+
+	svg := string(image)
+	for _, want := range []string{`width="232" height="232" viewBox="0 0 29 29"`, `fill="#ffeedd"`, `fill="#112233"`} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("SVG does not contain %q: %s", want, svg)
+		}
+	}
+}
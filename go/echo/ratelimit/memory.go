@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// Memory keeps the token buckets in memory, so limits are per instance
+type Memory struct {
+	mutex   sync.Mutex
+	buckets map[string]*bucket
+}
+
+// NewMemory creates a new Memory store instance
+func NewMemory() *Memory {
+	return &Memory{
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// TakeToken satisfies the Store interface
+func (m *Memory) TakeToken(ctx context.Context, key string, rate float64, burst int) (bool, float64, error) {
+	now := time.Now()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	b, exists := m.buckets[key]
+	if !exists {
+		b = &bucket{tokens: float64(burst), updatedAt: now}
+		m.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.updatedAt).Seconds()*rate)
+	b.updatedAt = now
+
+	if b.tokens < 1 {
+		return false, b.tokens, nil
+	}
+
+	b.tokens--
+	return true, b.tokens, nil
+}
+
+// SweepBuckets satisfies the Store interface
+func (m *Memory) SweepBuckets(ctx context.Context, idle time.Duration) error {
+	idleSince := time.Now().Add(-idle)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for key, b := range m.buckets {
+		if b.updatedAt.Before(idleSince) {
+			delete(m.buckets, key)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Policy describes a token bucket, which holds up to Burst tokens and is refilled with Rate tokens per second
+type Policy struct {
+	Name  string
+	Rate  float64
+	Burst int
+}
+
+// NewPolicy creates a new Policy instance refilled with perMinute tokens per minute
+func NewPolicy(name string, perMinute int, burst int) Policy {
+	return Policy{
+		Name:  name,
+		Rate:  float64(perMinute) / 60,
+		Burst: burst,
+	}
+}
+
+// RefillTime gets how long an empty bucket takes to be full again
+func (p Policy) RefillTime() time.Duration {
+	if p.Rate <= 0 {
+		return 0
+	}
+	return time.Duration(float64(p.Burst) / p.Rate * float64(time.Second))
+}
+
+// Store keeps the token buckets
+type Store interface {
+	// TakeToken refills the bucket by the elapsed time and takes a token if there is one,
+	// returning whether it was taken and the tokens left
+	TakeToken(ctx context.Context, key string, rate float64, burst int) (bool, float64, error)
+	// SweepBuckets removes the buckets not used for the idle duration
+	SweepBuckets(ctx context.Context, idle time.Duration) error
+}
+
+// Middleware limits the requests with the policy, using a bucket per key.
+// Requests are let through when the store fails, so an unavailable store does not take the service down.
+func Middleware(store Store, policy Policy, key func(echo.Context) string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			allowed, tokens, err := store.TakeToken(ctx.Request().Context(), policy.Name+":"+key(ctx), policy.Rate, policy.Burst)
+			if err != nil {
+				ctx.Logger().Error(err)
+				return next(ctx)
+			}
+
+			if !allowed {
+				retryAfter := 1
+				if policy.Rate > 0 {
+					retryAfter = int(math.Ceil((1 - tokens) / policy.Rate))
+				}
+				ctx.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(retryAfter))
+				return echo.NewHTTPError(http.StatusTooManyRequests)
+			}
+
+			return next(ctx)
+		}
+	}
+}
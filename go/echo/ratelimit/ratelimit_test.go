@@ -0,0 +1,124 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestNewPolicy(t *testing.T) {
+	tests := []struct {
+		perMinute int
+		burst     int
+		rate      float64
+		refill    time.Duration
+	}{
+		{60, 30, 1, 30 * time.Second},
+		{600, 100, 10, 10 * time.Second},
+		{10, 20, 1.0 / 6, 2 * time.Minute},
+		{0, 20, 0, 0},
+	}
+
+	for _, test := range tests {
+		policy := NewPolicy("test", test.perMinute, test.burst)
+		if policy.Rate != test.rate {
+			t.Errorf("NewPolicy(%d, %d).Rate = %v, want %v", test.perMinute, test.burst, policy.Rate, test.rate)
+		}
+		if refill := policy.RefillTime(); refill.Round(time.Millisecond) != test.refill {
+			t.Errorf("NewPolicy(%d, %d).RefillTime() = %v, want %v", test.perMinute, test.burst, refill, test.refill)
+		}
+	}
+}
+
+func TestMemoryTakeToken(t *testing.T) {
+	memory := NewMemory()
+
+	for i := 0; i < 3; i++ {
+		if allowed, _, _ := memory.TakeToken(context.Background(), "a", 0, 3); !allowed {
+			t.Fatalf("TakeToken %d of a burst of 3 was not allowed", i+1)
+		}
+	}
+	if allowed, tokens, _ := memory.TakeToken(context.Background(), "a", 0, 3); allowed || tokens >= 1 {
+		t.Errorf("TakeToken of an empty bucket = %v, %v, want false and less than a token", allowed, tokens)
+	}
+	if allowed, _, _ := memory.TakeToken(context.Background(), "b", 0, 3); !allowed {
+		t.Error("TakeToken of another key was not allowed")
+	}
+
+	// A bucket refilled with a token per millisecond has tokens again right away
+	memory.buckets["a"].updatedAt = time.Now().Add(-10 * time.Millisecond)
+	if allowed, _, _ := memory.TakeToken(context.Background(), "a", 1000, 3); !allowed {
+		t.Error("TakeToken of a refilled bucket was not allowed")
+	}
+}
+
+func TestMemorySweepBuckets(t *testing.T) {
+	memory := NewMemory()
+	memory.TakeToken(context.Background(), "idle", 1, 1)
+	memory.TakeToken(context.Background(), "active", 1, 1)
+	memory.buckets["idle"].updatedAt = time.Now().Add(-time.Hour)
+
+	if err := memory.SweepBuckets(context.Background(), time.Minute); err != nil {
+		t.Fatalf("SweepBuckets error = %v", err)
+	}
+	if _, exists := memory.buckets["idle"]; exists {
+		t.Error("SweepBuckets kept an idle bucket")
+	}
+	if _, exists := memory.buckets["active"]; !exists {
+		t.Error("SweepBuckets removed an active bucket")
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) TakeToken(ctx context.Context, key string, rate float64, burst int) (bool, float64, error) {
+	return false, 0, errors.New("store unavailable")
+}
+
+func (failingStore) SweepBuckets(ctx context.Context, idle time.Duration) error {
+	return nil
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		store      Store
+		requests   int
+		code       int
+		retryAfter string
+	}{
+		{"within burst", NewMemory(), 2, http.StatusOK, ""},
+		{"over burst", NewMemory(), 3, http.StatusTooManyRequests, "30"},
+		{"failing store", failingStore{}, 3, http.StatusOK, ""},
+	}
+
+	for _, test := range tests {
+		app := echo.New()
+		handler := Middleware(test.store, NewPolicy("test", 2, 2), func(ctx echo.Context) string {
+			return "client"
+		})(func(ctx echo.Context) error {
+			return ctx.NoContent(http.StatusOK)
+		})
+
+		var res *httptest.ResponseRecorder
+		var err error
+		for i := 0; i < test.requests; i++ {
+			res = httptest.NewRecorder()
+			err = handler(app.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), res))
+		}
+
+		code := res.Code
+		if httpErr, ok := err.(*echo.HTTPError); ok {
+			code = httpErr.Code
+		}
+		if code != test.code || res.Header().Get(echo.HeaderRetryAfter) != test.retryAfter {
+			t.Errorf("Middleware %s = %d with Retry-After %q, want %d with %q", test.name, code,
+				res.Header().Get(echo.HeaderRetryAfter), test.code, test.retryAfter)
+		}
+	}
+}
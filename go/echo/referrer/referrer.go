@@ -0,0 +1,143 @@
+package referrer
+
+import (
+	nurl "net/url"
+	"strings"
+)
+
+const (
+	SourceDirect   = "direct"
+	SourceSearch   = "search"
+	SourceSocial   = "social"
+	SourceEmail    = "email"
+	SourceReferral = "referral"
+)
+
+// Sources of well known domains, which also match their subdomains
+var domains = map[string]string{
+	"mail.google.com":       SourceEmail,
+	"inbox.google.com":      SourceEmail,
+	"outlook.live.com":      SourceEmail,
+	"outlook.office.com":    SourceEmail,
+	"outlook.office365.com": SourceEmail,
+	"mail.yahoo.com":        SourceEmail,
+	"mail.proton.me":        SourceEmail,
+	"mail.aol.com":          SourceEmail,
+	"mail.zoho.com":         SourceEmail,
+	"fastmail.com":          SourceEmail,
+	"search.brave.com":      SourceSearch,
+	"search.yahoo.com":      SourceSearch,
+	"duckduckgo.com":        SourceSearch,
+	"ecosia.org":            SourceSearch,
+	"startpage.com":         SourceSearch,
+	"qwant.com":             SourceSearch,
+	"baidu.com":             SourceSearch,
+	"naver.com":             SourceSearch,
+	"seznam.cz":             SourceSearch,
+	"facebook.com":          SourceSocial,
+	"fb.com":                SourceSocial,
+	"messenger.com":         SourceSocial,
+	"instagram.com":         SourceSocial,
+	"threads.net":           SourceSocial,
+	"twitter.com":           SourceSocial,
+	"x.com":                 SourceSocial,
+	"t.co":                  SourceSocial,
+	"linkedin.com":          SourceSocial,
+	"lnkd.in":               SourceSocial,
+	"reddit.com":            SourceSocial,
+	"pinterest.com":         SourceSocial,
+	"tiktok.com":            SourceSocial,
+	"youtube.com":           SourceSocial,
+	"news.ycombinator.com":  SourceSocial,
+	"bsky.app":              SourceSocial,
+	"mastodon.social":       SourceSocial,
+	"whatsapp.com":          SourceSocial,
+	"t.me":                  SourceSocial,
+	"discord.com":           SourceSocial,
+	"slack.com":             SourceSocial,
+	"vk.com":                SourceSocial,
+	"weibo.com":             SourceSocial,
+}
+
+// Search engines with a domain per country, like google.co.uk, matched by their name label
+var engines = map[string]bool{
+	"google": true,
+	"bing":   true,
+	"yahoo":  true,
+	"yandex": true,
+}
+
+// Android apps send their package name as the referrer host
+var apps = map[string]string{
+	"com.google.android.gm":                   SourceEmail,
+	"com.microsoft.office.outlook":            SourceEmail,
+	"com.google.android.googlequicksearchbox": SourceSearch,
+	"com.facebook.katana":                     SourceSocial,
+	"com.instagram.android":                   SourceSocial,
+	"com.twitter.android":                     SourceSocial,
+	"com.linkedin.android":                    SourceSocial,
+	"com.reddit.frontpage":                    SourceSocial,
+	"com.whatsapp":                            SourceSocial,
+	"org.telegram.messenger":                  SourceSocial,
+}
+
+// Referrer describes the classification of a referer header
+type Referrer struct {
+	Domain string // Empty for direct visits
+	Source string
+}
+
+// Parse normalizes the referer header to its domain, without www, mobile or link shim subdomains, and classifies its source.
+// Only the domain is kept, as paths and queries may identify the visitor.
+func Parse(referer string) Referrer {
+	direct := Referrer{Source: SourceDirect}
+
+	purl, err := nurl.Parse(strings.TrimSpace(referer))
+	if err != nil || purl.Hostname() == "" {
+		return direct
+	}
+
+	domain := strings.TrimSuffix(strings.ToLower(purl.Hostname()), ".")
+	if len(domain) > 253 {
+		return direct
+	}
+	if purl.Scheme == "android-app" {
+		if source, exists := apps[domain]; exists {
+			return Referrer{Domain: domain, Source: source}
+		}
+		return Referrer{Domain: domain, Source: SourceReferral}
+	}
+	if purl.Scheme != "http" && purl.Scheme != "https" {
+		return direct
+	}
+
+	for _, prefix := range []string{"www.", "m.", "mobile.", "l.", "lm."} {
+		domain = strings.TrimPrefix(domain, prefix)
+	}
+
+	return Referrer{Domain: domain, Source: classify(domain)}
+}
+
+func classify(domain string) string {
+	// The most specific domain wins, so mail.yahoo.com is email and yahoo.com is search
+	for parent := domain; parent != ""; {
+		if source, exists := domains[parent]; exists {
+			return source
+		}
+		dot := strings.IndexByte(parent, '.')
+		if dot < 0 {
+			break
+		}
+		parent = parent[dot+1:]
+	}
+
+	labels := strings.Split(domain, ".")
+	if len(labels) > 1 && engines[labels[0]] {
+		return SourceSearch
+	}
+	if labels[0] == "mail" || labels[0] == "webmail" {
+		return SourceEmail
+	}
+
+	return SourceReferral
+}
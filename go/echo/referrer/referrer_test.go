@@ -0,0 +1,37 @@
+package referrer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		referer string
+		want    Referrer
+	}{
+		{"", Referrer{Source: SourceDirect}},
+		{"not a url", Referrer{Source: SourceDirect}},
+		{"file:///home/user/page.html", Referrer{Source: SourceDirect}},
+		{"https://" + strings.Repeat("a", 254) + ".com/", Referrer{Source: SourceDirect}},
+		{"https://www.Example.com./path?user=42", Referrer{Domain: "example.com", Source: SourceReferral}},
+		{"https://t.co/abc", Referrer{Domain: "t.co", Source: SourceSocial}},
+		{"https://l.facebook.com/l.php?u=https%3A%2F%2Fshort.io", Referrer{Domain: "facebook.com", Source: SourceSocial}},
+		{"https://m.youtube.com/", Referrer{Domain: "youtube.com", Source: SourceSocial}},
+		{"https://old.reddit.com/r/golang", Referrer{Domain: "old.reddit.com", Source: SourceSocial}},
+		{"https://www.google.co.uk/", Referrer{Domain: "google.co.uk", Source: SourceSearch}},
+		{"https://duckduckgo.com/", Referrer{Domain: "duckduckgo.com", Source: SourceSearch}},
+		{"https://search.yahoo.com/search?p=shortr", Referrer{Domain: "search.yahoo.com", Source: SourceSearch}},
+		{"https://mail.yahoo.com/", Referrer{Domain: "mail.yahoo.com", Source: SourceEmail}},
+		{"https://mail.google.com/mail/u/0/", Referrer{Domain: "mail.google.com", Source: SourceEmail}},
+		{"https://webmail.example.org/", Referrer{Domain: "webmail.example.org", Source: SourceEmail}},
+		{"android-app://com.google.android.gm/", Referrer{Domain: "com.google.android.gm", Source: SourceEmail}},
+		{"android-app://com.example.reader", Referrer{Domain: "com.example.reader", Source: SourceReferral}},
+	}
+
+	for _, test := range tests {
+		if got := Parse(test.referer); got != test.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", test.referer, got, test.want)
+		}
+	}
+}
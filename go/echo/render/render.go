@@ -1,9 +1,12 @@
 package render
 
 import (
+	"fmt"
 	"html/template"
 	"io"
+	"shortr/charts"
 	"shortr/config"
+	"shortr/model"
 
 	"github.com/labstack/echo/v4"
 )
@@ -13,10 +16,18 @@ type Renderer struct {
 	templates *template.Template
 }
 
+var funcs = template.FuncMap{
+	"truncate":  truncate,
+	"series":    charts.Series,
+	"heatmap":   charts.Heatmap,
+	"bars":      bars,
+	"referrers": referrers,
+}
+
 // New creates a new Renderer instance
 func New(templates string) *Renderer {
 	return &Renderer{
-		templates: template.Must(template.ParseGlob(templates)),
+		templates: template.Must(template.New("").Funcs(funcs).ParseGlob(templates)),
 	}
 }
 
@@ -29,15 +40,61 @@ type context struct {
 
 // Render implements the standard render interface
 func (r *Renderer) Render(w io.Writer, name string, data interface{}, c echo.Context) error {
-	scheme := "http"
-	if config.GetEnvAsBool("APP_SSL_ENABLED", false) {
-		scheme = "https"
-	}
 	ctx := &context{
 		AppPort:   config.GetEnvAsInt("APP_PORT", 80),
-		AppHost:   config.GetEnvAsSlice("VIRTUAL_HOST", []string{"localhost"})[0],
-		AppScheme: scheme,
+		AppHost:   host(),
+		AppScheme: scheme(),
 		Scope:     data,
 	}
 	return r.templates.ExecuteTemplate(w, name, ctx)
 }
+
+// BaseURL returns the public url of the app, the same the templates use
+func BaseURL() string {
+	return fmt.Sprintf("%s://%s", scheme(), host())
+}
+
+func scheme() string {
+	if config.GetEnvAsBool("APP_SSL_ENABLED", false) {
+		return "https"
+	}
+	return "http"
+}
+
+func host() string {
+	return config.GetEnvAsSlice("VIRTUAL_HOST", []string{"localhost"})[0]
+}
+
+// truncate shortens the string, or string pointer, to length runes
+func truncate(value interface{}, length int) string {
+	var str string
+	switch v := value.(type) {
+	case string:
+		str = v
+	case *string:
+		if v != nil {
+			str = *v
+		}
+	default:
+		str = fmt.Sprint(v)
+	}
+
+	if runes := []rune(str); len(runes) > length {
+		return string(runes[:length]) + "..."
+	}
+	return str
+}
+
+// bars renders the values as a bars chart titled title, from the highest value to the lowest
+func bars(title string, values map[string]int) template.HTML {
+	return charts.Bars(title, charts.BarsOf(values))
+}
+
+// referrers renders the referrers, in order, as a bars chart
+func referrers(referrers []model.Referrer) template.HTML {
+	bars := make([]charts.Bar, 0, len(referrers))
+	for _, referrer := range referrers {
+		bars = append(bars, charts.Bar{Label: referrer.Domain, Value: referrer.Hits})
+	}
+	return charts.Bars("Top referrers", bars)
+}
@@ -0,0 +1,116 @@
+package render
+
+import (
+	"bytes"
+	"shortr/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderStats(t *testing.T) {
+	renderer := New("../../../static/templates/*.gts.html")
+	title := "Example"
+	checkStatus := "ok"
+
+	tests := []struct {
+		stats model.Stats
+		want  []string
+	}{
+		{
+			model.Stats{URL: model.URL{Name: "docs", URL: "https://example.com"}},
+			[]string{"<title>docs | Shortr</title>", `title="https://example.com"`, " https://example.com "},
+		},
+		{
+			model.Stats{
+				URL: model.URL{
+					Name:        "a-name-longer-than-ten",
+					URL:         "https://example.com/a/long/destination",
+					Hits:        42,
+					MetaTitle:   &title,
+					CheckStatus: &checkStatus,
+					Variants:    []model.Variant{{Name: "a", URL: "https://a.example.com", Weight: 1}},
+				},
+				VariantHits: map[string]int{"a": 40},
+				Changes:     []model.Change{{NewURL: "https://example.com/a/long/destination", ChangedAt: time.Now()}},
+				Series:      []model.Point{{Time: time.Now(), Hits: 42}},
+				HourOfWeek:  [7][24]int{{9: 42}},
+				Referrers:   []model.Referrer{{Domain: "news.ycombinator.com", Source: "social", Hits: 12}},
+				Countries:   map[string]int{"US": 30},
+			},
+			[]string{`title="https://example.com/a/long/destination"`, "https://example.com/...", "a-name-lon...",
+				`aria-label="Hits over time"`, `aria-label="Hits by hour of the week"`, `aria-label="Top referrers"`,
+				"news.ycombinator.com", `aria-label="Hits by variant"`},
+		},
+	}
+
+	for _, test := range tests {
+		var out bytes.Buffer
+		if err := renderer.Render(&out, "stats.gts.html", test.stats, nil); err != nil {
+			t.Fatalf("Render of the stats of %q error = %v", test.stats.Name, err)
+		}
+		for _, want := range test.want {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("Render of the stats of %q does not contain %q", test.stats.Name, want)
+			}
+		}
+	}
+}
+
+func TestRenderPreview(t *testing.T) {
+	renderer := New("../../../static/templates/*.gts.html")
+
+	tests := []struct {
+		preview model.Preview
+		want    []string
+	}{
+		{
+			model.Preview{URL: model.URL{Name: "app", URL: "https://app.example.com"}, Target: "https://app.example.com/#/a", Path: "/app", Safe: true},
+			[]string{`title="https://app.example.com/#/a"`, `action="/app"`, " Looks safe "},
+		},
+		{
+			model.Preview{
+				URL:    model.URL{Name: "docs", URL: "https://docs.example.com", Prefix: true},
+				Target: "https://docs.example.com/getting-started?utm_source=news",
+				Path:   "/docs/getting-started",
+				Query:  map[string][]string{"utm_source": {"news"}, "tag": {"a", "<b>"}},
+			},
+			[]string{`action="/docs/getting-started"`, `<input type="hidden" name="utm_source" value="news">`,
+				`<input type="hidden" name="tag" value="a">`, `<input type="hidden" name="tag" value="&lt;b&gt;">`},
+		},
+	}
+
+	for _, test := range tests {
+		var out bytes.Buffer
+		if err := renderer.Render(&out, "preview.gts.html", test.preview, nil); err != nil {
+			t.Fatalf("Render of the preview of %q error = %v", test.preview.Name, err)
+		}
+		for _, want := range test.want {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("Render of the preview of %q does not contain %q", test.preview.Name, want)
+			}
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	text := "héllo wörld"
+
+	tests := []struct {
+		value  interface{}
+		length int
+		want   string
+	}{
+		{"short", 10, "short"},
+		{text, 5, "héllo..."},
+		{&text, 11, text},
+		{(*string)(nil), 5, ""},
+		{42, 5, "42"},
+	}
+
+	for _, test := range tests {
+		if got := truncate(test.value, test.length); got != test.want {
+			t.Errorf("truncate(%v, %d) = %q, want %q", test.value, test.length, got, test.want)
+		}
+	}
+}
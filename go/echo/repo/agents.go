@@ -0,0 +1,46 @@
+package repo
+
+import (
+	"context"
+	"time"
+)
+
+// AddAgent counts a hit of the url by its id for the day from the browser, operating system and device type
+func (r *Repo) AddAgent(ctx context.Context, urlID int, day time.Time, browser string, os string, device string) error {
+	query := `INSERT INTO "agents" ("url_id", "day", "browser", "os", "device", "hits")
+			  VALUES ($1, $2, $3, $4, $5, 1)
+			  ON CONFLICT ("url_id", "day", "browser", "os", "device") DO UPDATE
+			  SET "hits" = "agents"."hits" + 1;`
+	_, err := r.conn.Exec(ctx, query, urlID, day, browser, os, device)
+	return err
+}
+
+// CountAgents counts the hits of the url by its id between from and to, both included,
+// for each browser, each operating system and each device type
+func (r *Repo) CountAgents(ctx context.Context, urlID int, from *time.Time, to *time.Time) (map[string]int, map[string]int, map[string]int, error) {
+	browsers, systems, devices := map[string]int{}, map[string]int{}, map[string]int{}
+	query := `SELECT "browser", "os", "device", SUM("hits") FROM "agents"
+			  WHERE "url_id" = $1
+			  AND ($2::DATE IS NULL OR "day" >= $2)
+			  AND ($3::DATE IS NULL OR "day" <= $3)
+			  GROUP BY "browser", "os", "device";`
+	rows, err := r.conn.Query(ctx, query, urlID, from, to)
+	if err != nil {
+		return browsers, systems, devices, err
+	}
+	defer rows.Close()
+
+	// Combinations are few, so they are summed up here instead of querying each breakdown
+	for rows.Next() {
+		var browser, os, device string
+		var count int
+		if err := rows.Scan(&browser, &os, &device, &count); err != nil {
+			return browsers, systems, devices, err
+		}
+		browsers[browser] += count
+		systems[os] += count
+		devices[device] += count
+	}
+
+	return browsers, systems, devices, rows.Err()
+}
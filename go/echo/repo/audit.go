@@ -0,0 +1,93 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"shortr/model"
+	"time"
+
+	"github.com/jackc/pgxutil"
+)
+
+const auditLock = 0x61756469 // Advisory lock serializing the appends to the audit chain
+
+// AppendAuditEntry chains the entry to the last entry of the audit log with the hash function and returns the new AuditEntry.
+// It runs in the transaction of the mutation, so the entry is committed along with it. Appends are serialized by the lock,
+// and an append chained to an entry its snapshot missed conflicts with the entry appended meanwhile, so the chain never forks.
+func (r *Repo) AppendAuditEntry(ctx context.Context, entry model.AuditEntry, hash func(string, model.AuditEntry) string) (model.AuditEntry, error) {
+	var AuditEntry model.AuditEntry
+
+	_, err := r.conn.Exec(ctx, `SELECT pg_advisory_xact_lock($1);`, auditLock)
+	if err != nil {
+		return AuditEntry, err
+	}
+
+	previous, err := pgxutil.SelectString(ctx, r.conn, `SELECT COALESCE((SELECT "hash" FROM "audit" ORDER BY "id" DESC LIMIT 1), '');`)
+	if err != nil {
+		return AuditEntry, err
+	}
+
+	// Timestamps are stored with microsecond precision, so they are hashed the same way
+	entry.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	entry.PrevHash = previous
+	entry.Hash = hash(previous, entry)
+
+	query := `INSERT INTO "audit" ("subject", "action", "url_id", "actor", "ip", "user_agent", "request_id", "before", "after", "created_at", "prev_hash", "hash")
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+			  RETURNING *;`
+	err = pgxutil.SelectStruct(ctx, r.conn, &AuditEntry, query, entry.Subject, entry.Action, entry.URLID, entry.Actor, entry.IP, entry.UserAgent,
+		entry.RequestID, text(entry.Before), text(entry.After), entry.CreatedAt, entry.PrevHash, entry.Hash)
+	if err != nil {
+		switch {
+		case rErrNoRows.MatchString(err.Error()):
+			return AuditEntry, ErrNoRows
+		case rErrIntegrityViolation.MatchString(err.Error()):
+			// Previous hashes are unique, so the entry was chained to a stale last entry
+			return AuditEntry, ErrConflict
+		}
+		return AuditEntry, err
+	}
+
+	return AuditEntry, nil
+}
+
+// AuditFilter describes the optional filters when listing audit entries
+type AuditFilter struct {
+	Subject *string
+	URLID   *int
+	Action  *string
+	Actor   *string
+}
+
+// ListAuditEntries retrieves the audit entries matching the filter, newest first
+func (r *Repo) ListAuditEntries(ctx context.Context, filter AuditFilter, limit int, offset int) ([]model.AuditEntry, error) {
+	AuditEntries := []model.AuditEntry{}
+	query := `SELECT * FROM "audit"
+			  WHERE ($1::INTEGER IS NULL OR "url_id" = $1)
+			  AND ($2::VARCHAR IS NULL OR "action" = $2)
+			  AND ($3::VARCHAR IS NULL OR "actor" = $3)
+			  AND ($4::VARCHAR IS NULL OR "subject" = $4)
+			  ORDER BY "id" DESC
+			  LIMIT $5 OFFSET $6;`
+	err := pgxutil.SelectAllStruct(ctx, r.conn, &AuditEntries, query, filter.URLID, filter.Action, filter.Actor, filter.Subject, limit, offset)
+	return AuditEntries, err
+}
+
+// GetAuditEntriesAfter retrieves up to limit audit entries after the given id, in chain order
+func (r *Repo) GetAuditEntriesAfter(ctx context.Context, afterID int64, limit int) ([]model.AuditEntry, error) {
+	AuditEntries := []model.AuditEntry{}
+	query := `SELECT * FROM "audit"
+			  WHERE "id" > $1
+			  ORDER BY "id"
+			  LIMIT $2;`
+	err := pgxutil.SelectAllStruct(ctx, r.conn, &AuditEntries, query, afterID, limit)
+	return AuditEntries, err
+}
+
+func text(raw json.RawMessage) *string {
+	if raw == nil {
+		return nil
+	}
+	value := string(raw)
+	return &value
+}
@@ -0,0 +1,56 @@
+package repo
+
+import (
+	"context"
+	"shortr/model"
+	"time"
+
+	"github.com/jackc/pgxutil"
+)
+
+// CreateChange creates a new entry for the destination change of an url and returns the new Change
+func (r *Repo) CreateChange(ctx context.Context, change model.Change) (model.Change, error) {
+	var Change model.Change
+	changedAt := time.Now()
+	query := `INSERT INTO "changes" ("url_id", "old_url", "new_url", "changed_at", "actor")
+			  VALUES ($1, $2, $3, $4, $5)
+			  RETURNING *;`
+	err := pgxutil.SelectStruct(ctx, r.conn, &Change, query, change.URLID, change.OldURL, change.NewURL, changedAt, change.Actor)
+	if err != nil {
+		switch {
+		case rErrNoRows.MatchString(err.Error()):
+			return Change, ErrNoRows
+		case rErrIntegrityViolation.MatchString(err.Error()):
+			return Change, ErrIntegrityViolation
+		}
+	}
+	return Change, err
+}
+
+// GetChangeByID retrieves the destination change of the url by its id
+func (r *Repo) GetChangeByID(ctx context.Context, urlID int, id int) (model.Change, error) {
+	var Change model.Change
+	query := `SELECT * FROM "changes"
+			  WHERE "id" = $1 AND "url_id" = $2;`
+	err := pgxutil.SelectStruct(ctx, r.conn, &Change, query, id, urlID)
+	if err != nil {
+		switch {
+		case rErrNoRows.MatchString(err.Error()):
+			return Change, ErrNoRows
+		case rErrIntegrityViolation.MatchString(err.Error()):
+			return Change, ErrIntegrityViolation
+		}
+	}
+	return Change, err
+}
+
+// GetChangesByURLID retrieves the destination changes of the url by its id, newest first
+func (r *Repo) GetChangesByURLID(ctx context.Context, urlID int, limit int, offset int) ([]model.Change, error) {
+	Changes := []model.Change{}
+	query := `SELECT * FROM "changes"
+			  WHERE "url_id" = $1
+			  ORDER BY "changed_at" DESC, "id" DESC
+			  LIMIT $2 OFFSET $3;`
+	err := pgxutil.SelectAllStruct(ctx, r.conn, &Changes, query, urlID, limit, offset)
+	return Changes, err
+}
@@ -0,0 +1,29 @@
+package repo
+
+import (
+	"context"
+	"shortr/model"
+	"time"
+
+	"github.com/jackc/pgxutil"
+)
+
+// CreateClick creates a new entry for the click of an url and returns the new Click
+func (r *Repo) CreateClick(ctx context.Context, click model.Click) (model.Click, error) {
+	var Click model.Click
+	clickedAt := time.Now()
+	query := `INSERT INTO "clicks" ("url_id", "clicked_at", "os", "device", "variant", "bot", "referrer", "source", "country", "region", "browser")
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			  RETURNING *;`
+	err := pgxutil.SelectStruct(ctx, r.conn, &Click, query, click.URLID, clickedAt, click.OS, click.Device, click.Variant, click.Bot,
+		click.Referrer, click.Source, click.Country, click.Region, click.Browser)
+	if err != nil {
+		switch {
+		case rErrNoRows.MatchString(err.Error()):
+			return Click, ErrNoRows
+		case rErrIntegrityViolation.MatchString(err.Error()):
+			return Click, ErrIntegrityViolation
+		}
+	}
+	return Click, err
+}
@@ -0,0 +1,105 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"shortr/model"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// ExportFilter describes the links and the time range of an export
+type ExportFilter struct {
+	Names []string
+	From  *time.Time
+	To    *time.Time
+}
+
+// ExportClicks streams the clicks of the links matching the filter, ordered by link and time, calling fn with each one
+func (r *Repo) ExportClicks(ctx context.Context, filter ExportFilter, batchSize int, fn func(string, model.Click) error) error {
+	query := `SELECT "urls"."name", "clicks"."id", "clicks"."url_id", "clicks"."clicked_at", "clicks"."os", "clicks"."device",
+					 "clicks"."variant", "clicks"."bot", "clicks"."referrer", "clicks"."source",
+					 "clicks"."country", "clicks"."region", "clicks"."browser"
+			  FROM "clicks"
+			  JOIN "urls" ON "urls"."id" = "clicks"."url_id"
+			  WHERE "urls"."name" = ANY($1) AND "urls"."deleted_at" IS NULL
+			  AND ($2::TIMESTAMPTZ IS NULL OR "clicks"."clicked_at" >= $2)
+			  AND ($3::TIMESTAMPTZ IS NULL OR "clicks"."clicked_at" < $3)
+			  ORDER BY "urls"."name", "clicks"."clicked_at", "clicks"."id"`
+	return r.stream(ctx, batchSize, query, []interface{}{filter.Names, filter.From, filter.To}, func(rows pgx.Rows) error {
+		var name string
+		var click model.Click
+		err := rows.Scan(&name, &click.ID, &click.URLID, &click.ClickedAt, &click.OS, &click.Device, &click.Variant, &click.Bot,
+			&click.Referrer, &click.Source, &click.Country, &click.Region, &click.Browser)
+		if err != nil {
+			return err
+		}
+		return fn(name, click)
+	})
+}
+
+// ExportSeries streams the hits of the links matching the filter aggregated by interval, that is hour, day, week or month,
+// from the hourly hit counters, ordered by link and time, calling fn with each point
+func (r *Repo) ExportSeries(ctx context.Context, filter ExportFilter, interval string, batchSize int, fn func(model.Point) error) error {
+	query := `SELECT "urls"."name", DATE_TRUNC($4, "hourly_hits"."hour", 'UTC') AS "bucket",
+					 SUM("hourly_hits"."hits"), SUM("hourly_hits"."bot_hits")
+			  FROM "hourly_hits"
+			  JOIN "urls" ON "urls"."id" = "hourly_hits"."url_id"
+			  WHERE "urls"."name" = ANY($1) AND "urls"."deleted_at" IS NULL
+			  AND ($2::TIMESTAMPTZ IS NULL OR "hourly_hits"."hour" >= $2)
+			  AND ($3::TIMESTAMPTZ IS NULL OR "hourly_hits"."hour" < $3)
+			  GROUP BY "urls"."name", "bucket"
+			  ORDER BY "urls"."name", "bucket"`
+	return r.stream(ctx, batchSize, query, []interface{}{filter.Names, filter.From, filter.To, interval}, func(rows pgx.Rows) error {
+		var point model.Point
+		err := rows.Scan(&point.Name, &point.Time, &point.Hits, &point.BotHits)
+		if err != nil {
+			return err
+		}
+		return fn(point)
+	})
+}
+
+// stream runs the query through a server side cursor in a read only transaction,
+// so rows are fetched batchSize at a time instead of being loaded at once
+func (r *Repo) stream(ctx context.Context, batchSize int, query string, args []interface{}, scan func(pgx.Rows) error) error {
+	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel:   pgx.RepeatableRead,
+		AccessMode: pgx.ReadOnly,
+	})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx) // Closes the cursor
+
+	_, err = tx.Exec(ctx, `DECLARE "export" NO SCROLL CURSOR FOR `+query, args...)
+	if err != nil {
+		return err
+	}
+
+	fetch := fmt.Sprintf(`FETCH FORWARD %d FROM "export";`, batchSize)
+	for {
+		rows, err := tx.Query(ctx, fetch)
+		if err != nil {
+			return err
+		}
+
+		fetched := 0
+		for rows.Next() {
+			fetched++
+			if err := scan(rows); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if fetched < batchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package repo
+
+import (
+	"context"
+	"shortr/model"
+	"time"
+)
+
+// AddHit counts a visit of the url by its id in the UTC hour of at, as a bot hit for bots
+func (r *Repo) AddHit(ctx context.Context, urlID int, at time.Time, bot bool) error {
+	hits, botHits := 1, 0
+	if bot {
+		hits, botHits = 0, 1
+	}
+	query := `INSERT INTO "hourly_hits" ("url_id", "hour", "hits", "bot_hits")
+			  VALUES ($1, DATE_TRUNC('hour', $2::TIMESTAMPTZ, 'UTC'), $3, $4)
+			  ON CONFLICT ("url_id", "hour") DO UPDATE
+			  SET "hits" = "hourly_hits"."hits" + EXCLUDED."hits", "bot_hits" = "hourly_hits"."bot_hits" + EXCLUDED."bot_hits";`
+	_, err := r.conn.Exec(ctx, query, urlID, at, hits, botHits)
+	return err
+}
+
+// GetDailyHits retrieves the hits of the url by its id for each UTC day between from and to, both included.
+// Days without hits are omitted.
+func (r *Repo) GetDailyHits(ctx context.Context, urlID int, from *time.Time, to *time.Time) ([]model.Point, error) {
+	points := []model.Point{}
+	query := `SELECT DATE_TRUNC('day', "hour", 'UTC') AS "day", SUM("hits"), SUM("bot_hits")
+			  FROM "hourly_hits"
+			  WHERE "url_id" = $1
+			  AND ($2::DATE IS NULL OR "hour" >= $2::TIMESTAMP AT TIME ZONE 'UTC')
+			  AND ($3::DATE IS NULL OR "hour" < ($3::DATE + 1)::TIMESTAMP AT TIME ZONE 'UTC')
+			  GROUP BY "day"
+			  ORDER BY "day";`
+	rows, err := r.conn.Query(ctx, query, urlID, from, to)
+	if err != nil {
+		return points, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var point model.Point
+		if err := rows.Scan(&point.Time, &point.Hits, &point.BotHits); err != nil {
+			return points, err
+		}
+		points = append(points, point)
+	}
+
+	return points, rows.Err()
+}
+
+// GetHourOfWeekHits retrieves the human hits of the url by its id between from and to, both included,
+// for each UTC hour of each day of the week, starting on Monday
+func (r *Repo) GetHourOfWeekHits(ctx context.Context, urlID int, from *time.Time, to *time.Time) ([7][24]int, error) {
+	var hits [7][24]int
+	query := `SELECT EXTRACT(ISODOW FROM "hour" AT TIME ZONE 'UTC')::INTEGER - 1 AS "weekday",
+					 EXTRACT(HOUR FROM "hour" AT TIME ZONE 'UTC')::INTEGER AS "hour_of_day", SUM("hits")
+			  FROM "hourly_hits"
+			  WHERE "url_id" = $1
+			  AND ($2::DATE IS NULL OR "hour" >= $2::TIMESTAMP AT TIME ZONE 'UTC')
+			  AND ($3::DATE IS NULL OR "hour" < ($3::DATE + 1)::TIMESTAMP AT TIME ZONE 'UTC')
+			  GROUP BY "weekday", "hour_of_day";`
+	rows, err := r.conn.Query(ctx, query, urlID, from, to)
+	if err != nil {
+		return hits, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var weekday, hour, count int
+		if err := rows.Scan(&weekday, &hour, &count); err != nil {
+			return hits, err
+		}
+		hits[weekday][hour] = count
+	}
+
+	return hits, rows.Err()
+}
@@ -0,0 +1,62 @@
+package repo
+
+import (
+	"context"
+	"time"
+)
+
+// AddLocation counts a hit of the url by its id for the day from the country and region, empty when they are unknown
+func (r *Repo) AddLocation(ctx context.Context, urlID int, day time.Time, country string, region string) error {
+	query := `INSERT INTO "locations" ("url_id", "day", "country", "region", "hits")
+			  VALUES ($1, $2, $3, $4, 1)
+			  ON CONFLICT ("url_id", "day", "country", "region") DO UPDATE
+			  SET "hits" = "locations"."hits" + 1;`
+	_, err := r.conn.Exec(ctx, query, urlID, day, country, region)
+	return err
+}
+
+// CountTopLocationsByCountry counts the hits of the url by its id between from and to, both included,
+// for the limit known countries with the most hits
+func (r *Repo) CountTopLocationsByCountry(ctx context.Context, urlID int, from *time.Time, to *time.Time, limit int) (map[string]int, error) {
+	query := `SELECT "country", SUM("hits") AS "total" FROM "locations"
+			  WHERE "url_id" = $1 AND "country" <> ''
+			  AND ($2::DATE IS NULL OR "day" >= $2)
+			  AND ($3::DATE IS NULL OR "day" <= $3)
+			  GROUP BY "country"
+			  ORDER BY "total" DESC, "country"
+			  LIMIT $4;`
+	return r.countLocations(ctx, query, urlID, from, to, limit)
+}
+
+// CountTopLocationsByRegion counts the hits of the url by its id between from and to, both included,
+// for the limit known regions with the most hits
+func (r *Repo) CountTopLocationsByRegion(ctx context.Context, urlID int, from *time.Time, to *time.Time, limit int) (map[string]int, error) {
+	query := `SELECT "region", SUM("hits") AS "total" FROM "locations"
+			  WHERE "url_id" = $1 AND "region" <> ''
+			  AND ($2::DATE IS NULL OR "day" >= $2)
+			  AND ($3::DATE IS NULL OR "day" <= $3)
+			  GROUP BY "region"
+			  ORDER BY "total" DESC, "region"
+			  LIMIT $4;`
+	return r.countLocations(ctx, query, urlID, from, to, limit)
+}
+
+func (r *Repo) countLocations(ctx context.Context, query string, args ...interface{}) (map[string]int, error) {
+	counts := map[string]int{}
+	rows, err := r.conn.Query(ctx, query, args...)
+	if err != nil {
+		return counts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var location string
+		var count int
+		if err := rows.Scan(&location, &count); err != nil {
+			return counts, err
+		}
+		counts[location] = count
+	}
+
+	return counts, rows.Err()
+}
@@ -0,0 +1,46 @@
+package repo
+
+import (
+	"context"
+	"time"
+)
+
+// TakeToken refills the token bucket by its key and takes a token if there is one, returning whether it was taken
+// and the tokens left. The bucket is updated in a single statement, so instances sharing it never take the same token.
+func (r *Repo) TakeToken(ctx context.Context, key string, rate float64, burst int) (bool, float64, error) {
+	var allowed bool
+	var tokens float64
+	updatedAt := time.Now()
+	// Every expression reads the bucket before the update, refilled by the time elapsed since
+	refilled := `LEAST($3::FLOAT, "rate_limits"."tokens" + GREATEST(EXTRACT(EPOCH FROM $4::TIMESTAMPTZ - "rate_limits"."updated_at")::FLOAT, 0) * $2::FLOAT)`
+	query := `INSERT INTO "rate_limits" ("key", "tokens", "allowed", "updated_at")
+			  VALUES ($1, $3::FLOAT - 1, $3::FLOAT >= 1, $4::TIMESTAMPTZ)
+			  ON CONFLICT ("key") DO UPDATE
+			  SET "tokens" = ` + refilled + ` - CASE WHEN ` + refilled + ` >= 1 THEN 1 ELSE 0 END,
+			      "allowed" = ` + refilled + ` >= 1,
+			      "updated_at" = $4::TIMESTAMPTZ
+			  RETURNING "allowed", "tokens";`
+	rows, err := r.conn.Query(ctx, query, key, rate, burst, updatedAt)
+	if err != nil {
+		return allowed, tokens, err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		err = rows.Scan(&allowed, &tokens)
+		if err != nil {
+			return allowed, tokens, err
+		}
+	}
+
+	return allowed, tokens, rows.Err()
+}
+
+// SweepBuckets deletes the token buckets not used for the idle duration
+func (r *Repo) SweepBuckets(ctx context.Context, idle time.Duration) error {
+	idleSince := time.Now().Add(-idle)
+	query := `DELETE FROM "rate_limits"
+			  WHERE "updated_at" < $1;`
+	_, err := r.conn.Exec(ctx, query, idleSince)
+	return err
+}
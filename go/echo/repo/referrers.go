@@ -0,0 +1,71 @@
+package repo
+
+import (
+	"context"
+	"shortr/model"
+	"time"
+)
+
+// AddReferrer counts a hit of the url by its id for the day referred by the domain, empty for direct hits
+func (r *Repo) AddReferrer(ctx context.Context, urlID int, day time.Time, domain string, source string) error {
+	query := `INSERT INTO "referrers" ("url_id", "day", "domain", "source", "hits")
+			  VALUES ($1, $2, $3, $4, 1)
+			  ON CONFLICT ("url_id", "day", "domain") DO UPDATE
+			  SET "hits" = "referrers"."hits" + 1;`
+	_, err := r.conn.Exec(ctx, query, urlID, day, domain, source)
+	return err
+}
+
+// GetTopReferrers retrieves the limit domains referring the most hits to the url by its id
+// between from and to, both included, ordered by hits
+func (r *Repo) GetTopReferrers(ctx context.Context, urlID int, from *time.Time, to *time.Time, limit int) ([]model.Referrer, error) {
+	referrers := []model.Referrer{}
+	query := `SELECT "domain", MIN("source"), SUM("hits") AS "total" FROM "referrers"
+			  WHERE "url_id" = $1 AND "domain" <> ''
+			  AND ($2::DATE IS NULL OR "day" >= $2)
+			  AND ($3::DATE IS NULL OR "day" <= $3)
+			  GROUP BY "domain"
+			  ORDER BY "total" DESC, "domain"
+			  LIMIT $4;`
+	rows, err := r.conn.Query(ctx, query, urlID, from, to, limit)
+	if err != nil {
+		return referrers, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var referrer model.Referrer
+		if err := rows.Scan(&referrer.Domain, &referrer.Source, &referrer.Hits); err != nil {
+			return referrers, err
+		}
+		referrers = append(referrers, referrer)
+	}
+
+	return referrers, rows.Err()
+}
+
+// CountReferrersBySource counts the hits of the url by its id between from and to, both included, for each source
+func (r *Repo) CountReferrersBySource(ctx context.Context, urlID int, from *time.Time, to *time.Time) (map[string]int, error) {
+	counts := map[string]int{}
+	query := `SELECT "source", SUM("hits") FROM "referrers"
+			  WHERE "url_id" = $1
+			  AND ($2::DATE IS NULL OR "day" >= $2)
+			  AND ($3::DATE IS NULL OR "day" <= $3)
+			  GROUP BY "source";`
+	rows, err := r.conn.Query(ctx, query, urlID, from, to)
+	if err != nil {
+		return counts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var source string
+		var count int
+		if err := rows.Scan(&source, &count); err != nil {
+			return counts, err
+		}
+		counts[source] = count
+	}
+
+	return counts, rows.Err()
+}
@@ -19,6 +19,10 @@ var ErrNoRows = pgx.ErrNoRows
 var rErrNoRows = regexp.MustCompile(fmt.Sprintf("^%s$", pgx.ErrNoRows))
 var ErrIntegrityViolation = errors.New("integrity constraint violation")
 var rErrIntegrityViolation = regexp.MustCompile(fmt.Sprintf("(SQLSTATE %s)", pgerrcode.UniqueViolation))
+var ErrConflict = errors.New("concurrent transaction conflict")
+var rErrConflict = regexp.MustCompile(fmt.Sprintf("(SQLSTATE %s)", pgerrcode.SerializationFailure))
+
+const transactionAttempts = 3 // Attempts of a transaction conflicting with concurrent ones
 
 // Repo describes the URLs repository
 type Repo struct {
@@ -48,7 +52,19 @@ func (r *Repo) Disconnect() {
 	r.db.Close()
 }
 
+// Transaction runs fn in a serializable transaction, which is retried while it conflicts with concurrent transactions
 func (r *Repo) Transaction(ctx context.Context, fn func(*Repo) error) error {
+	var err error
+	for attempt := 0; attempt < transactionAttempts; attempt++ {
+		err = r.transaction(ctx, fn)
+		if err != ErrConflict && (err == nil || !rErrConflict.MatchString(err.Error())) {
+			return err
+		}
+	}
+	return err
+}
+
+func (r *Repo) transaction(ctx context.Context, fn func(*Repo) error) error {
 	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{
 		IsoLevel:   pgx.Serializable,
 		AccessMode: pgx.ReadWrite,
@@ -97,7 +113,7 @@ func (r *Repo) GetByID(ctx context.Context, id int) (model.URL, error) {
 func (r *Repo) GetByName(ctx context.Context, name string) (model.URL, error) {
 	var URL model.URL
 	query := `SELECT * FROM "urls"
-			  WHERE "name" = $1;`
+			  WHERE "name" = $1 AND "deleted_at" IS NULL;`
 	err := pgxutil.SelectStruct(ctx, r.conn, &URL, query, name)
 	if err != nil {
 		switch {
@@ -110,15 +126,51 @@ func (r *Repo) GetByName(ctx context.Context, name string) (model.URL, error) {
 	return URL, err
 }
 
-// Create creates a new entry for the url and returns the new URL
-func (r *Repo) Create(ctx context.Context, url string) (model.URL, error) {
+// GetDeletedByName retrieves the deleted URL by its name, while it is not purged
+func (r *Repo) GetDeletedByName(ctx context.Context, name string) (model.URL, error) {
+	var URL model.URL
+	query := `SELECT * FROM "urls"
+			  WHERE "name" = $1 AND "deleted_at" IS NOT NULL;`
+	err := pgxutil.SelectStruct(ctx, r.conn, &URL, query, name)
+	if err != nil {
+		switch {
+		case rErrNoRows.MatchString(err.Error()):
+			return URL, ErrNoRows
+		case rErrIntegrityViolation.MatchString(err.Error()):
+			return URL, ErrIntegrityViolation
+		}
+	}
+	return URL, err
+}
+
+// GetByDedupKey retrieves the url which is not in the trash by its deduplication key
+func (r *Repo) GetByDedupKey(ctx context.Context, dedupKey string) (model.URL, error) {
+	var URL model.URL
+	query := `SELECT * FROM "urls"
+			  WHERE "dedup_key" = $1 AND "deleted_at" IS NULL;`
+	err := pgxutil.SelectStruct(ctx, r.conn, &URL, query, dedupKey)
+	if err != nil {
+		switch {
+		case rErrNoRows.MatchString(err.Error()):
+			return URL, ErrNoRows
+		case rErrIntegrityViolation.MatchString(err.Error()):
+			return URL, ErrIntegrityViolation
+		}
+	}
+	return URL, err
+}
+
+// Create creates a new entry for the url with its options and returns the new URL.
+// When the deduplication key is already taken nothing is created, and ErrNoRows is returned.
+func (r *Repo) Create(ctx context.Context, url string, expandedURL *string, queryMode string, prefix bool, dedupKey *string) (model.URL, error) {
 	var URL model.URL
 	createdAt := time.Now()
 	modifiedAt := createdAt
-	query := `INSERT INTO "urls" ("url", "created_at", "modified_at")
-			  VALUES ($1, $2, $3)
+	query := `INSERT INTO "urls" ("url", "expanded_url", "query_mode", "prefix", "dedup_key", "created_at", "modified_at")
+			  VALUES ($1, $2, $3, $4, $5, $6, $7)
+			  ON CONFLICT ("dedup_key") DO NOTHING
 			  RETURNING *;`
-	err := pgxutil.SelectStruct(ctx, r.conn, &URL, query, url, createdAt, modifiedAt)
+	err := pgxutil.SelectStruct(ctx, r.conn, &URL, query, url, expandedURL, queryMode, prefix, dedupKey, createdAt, modifiedAt)
 	if err != nil {
 		switch {
 		case rErrNoRows.MatchString(err.Error()):
@@ -151,14 +203,35 @@ func (r *Repo) UpdateNameByID(ctx context.Context, id int, name string) (model.U
 }
 
 // UpdateURLByID updates the url by its id and returns the updated URL
-func (r *Repo) UpdateURLByID(ctx context.Context, id int, url string) (model.URL, error) {
+func (r *Repo) UpdateURLByID(ctx context.Context, id int, url string, expandedURL *string) (model.URL, error) {
 	var URL model.URL
 	modifiedAt := time.Now()
 	query := `UPDATE "urls"
-	          SET "url" = $1, "modified_at" = $2
+	          SET "url" = $1, "expanded_url" = $2, "modified_at" = $3, "dedup_key" = NULL,
+			      "meta_title" = NULL, "meta_description" = NULL, "meta_image" = NULL, "meta_favicon" = NULL
+			  WHERE "id" = $4
+			  RETURNING *;`
+	err := pgxutil.SelectStruct(ctx, r.conn, &URL, query, url, expandedURL, modifiedAt, id)
+	if err != nil {
+		switch {
+		case rErrNoRows.MatchString(err.Error()):
+			return URL, ErrNoRows
+		case rErrIntegrityViolation.MatchString(err.Error()):
+			return URL, ErrIntegrityViolation
+		}
+	}
+	return URL, err
+}
+
+// UpdateRulesByID updates the conditional destinations for the url by its id and returns the updated URL
+func (r *Repo) UpdateRulesByID(ctx context.Context, id int, rules []model.Rule) (model.URL, error) {
+	var URL model.URL
+	modifiedAt := time.Now()
+	query := `UPDATE "urls"
+			  SET "rules" = $1, "modified_at" = $2, "dedup_key" = NULL
 			  WHERE "id" = $3
 			  RETURNING *;`
-	err := pgxutil.SelectStruct(ctx, r.conn, &URL, query, url, modifiedAt, id)
+	err := pgxutil.SelectStruct(ctx, r.conn, &URL, query, rules, modifiedAt, id)
 	if err != nil {
 		switch {
 		case rErrNoRows.MatchString(err.Error()):
@@ -170,15 +243,74 @@ func (r *Repo) UpdateURLByID(ctx context.Context, id int, url string) (model.URL
 	return URL, err
 }
 
-// UpdateURLByName updates the url by its name and returns the updated URL
-func (r *Repo) UpdateURLByName(ctx context.Context, name string, url string) (model.URL, error) {
+// UpdatePlatformsByID updates the platform destinations for the url by its id and returns the updated URL
+func (r *Repo) UpdatePlatformsByID(ctx context.Context, id int, platforms map[string]string) (model.URL, error) {
 	var URL model.URL
 	modifiedAt := time.Now()
 	query := `UPDATE "urls"
-			  SET "url" = $1, "modified_at" = $2
-			  WHERE "name" = $3
+			  SET "platforms" = $1, "modified_at" = $2, "dedup_key" = NULL
+			  WHERE "id" = $3
 			  RETURNING *;`
-	err := pgxutil.SelectStruct(ctx, r.conn, &URL, query, url, modifiedAt, name)
+	err := pgxutil.SelectStruct(ctx, r.conn, &URL, query, platforms, modifiedAt, id)
+	if err != nil {
+		switch {
+		case rErrNoRows.MatchString(err.Error()):
+			return URL, ErrNoRows
+		case rErrIntegrityViolation.MatchString(err.Error()):
+			return URL, ErrIntegrityViolation
+		}
+	}
+	return URL, err
+}
+
+// UpdateVariantsByID updates the weighted destinations for the url by its id and returns the updated URL
+func (r *Repo) UpdateVariantsByID(ctx context.Context, id int, variants []model.Variant, sticky bool) (model.URL, error) {
+	var URL model.URL
+	modifiedAt := time.Now()
+	query := `UPDATE "urls"
+			  SET "variants" = $1, "sticky_variants" = $2, "modified_at" = $3, "dedup_key" = NULL
+			  WHERE "id" = $4
+			  RETURNING *;`
+	err := pgxutil.SelectStruct(ctx, r.conn, &URL, query, variants, sticky, modifiedAt, id)
+	if err != nil {
+		switch {
+		case rErrNoRows.MatchString(err.Error()):
+			return URL, ErrNoRows
+		case rErrIntegrityViolation.MatchString(err.Error()):
+			return URL, ErrIntegrityViolation
+		}
+	}
+	return URL, err
+}
+
+// UpdateMetadataByID updates the destination page metadata for the url by its id and returns the updated URL
+func (r *Repo) UpdateMetadataByID(ctx context.Context, id int, title *string, description *string, image *string, favicon *string) (model.URL, error) {
+	var URL model.URL
+	query := `UPDATE "urls"
+			  SET "meta_title" = $1, "meta_description" = $2, "meta_image" = $3, "meta_favicon" = $4
+			  WHERE "id" = $5
+			  RETURNING *;`
+	err := pgxutil.SelectStruct(ctx, r.conn, &URL, query, title, description, image, favicon, id)
+	if err != nil {
+		switch {
+		case rErrNoRows.MatchString(err.Error()):
+			return URL, ErrNoRows
+		case rErrIntegrityViolation.MatchString(err.Error()):
+			return URL, ErrIntegrityViolation
+		}
+	}
+	return URL, err
+}
+
+// UpdateOptionsByID updates the redirect options for the url by its id and returns the updated URL
+func (r *Repo) UpdateOptionsByID(ctx context.Context, id int, queryMode string, prefix bool) (model.URL, error) {
+	var URL model.URL
+	modifiedAt := time.Now()
+	query := `UPDATE "urls"
+			  SET "query_mode" = $1, "prefix" = $2, "modified_at" = $3, "dedup_key" = NULL
+			  WHERE "id" = $4
+			  RETURNING *;`
+	err := pgxutil.SelectStruct(ctx, r.conn, &URL, query, queryMode, prefix, modifiedAt, id)
 	if err != nil {
 		switch {
 		case rErrNoRows.MatchString(err.Error()):
@@ -210,15 +342,14 @@ func (r *Repo) UpdateMetricsByID(ctx context.Context, id int) (model.URL, error)
 	return URL, err
 }
 
-// UpdateMetricsByName updates the metrics for the url by its name and returns the updated URL
-func (r *Repo) UpdateMetricsByName(ctx context.Context, name string) (model.URL, error) {
+// UpdateBotMetricsByID counts a bot visit for the url by its id and returns the updated URL
+func (r *Repo) UpdateBotMetricsByID(ctx context.Context, id int) (model.URL, error) {
 	var URL model.URL
-	lastHitAt := time.Now()
 	query := `UPDATE "urls"
-			  SET "hits" = "hits" + 1, "last_hit_at" = $1
-			  WHERE "name" = $2
+			  SET "bot_hits" = "bot_hits" + 1
+			  WHERE "id" = $1
 			  RETURNING *;`
-	err := pgxutil.SelectStruct(ctx, r.conn, &URL, query, lastHitAt, name)
+	err := pgxutil.SelectStruct(ctx, r.conn, &URL, query, id)
 	if err != nil {
 		switch {
 		case rErrNoRows.MatchString(err.Error()):
@@ -230,13 +361,75 @@ func (r *Repo) UpdateMetricsByName(ctx context.Context, name string) (model.URL,
 	return URL, err
 }
 
-// DeleteByID deletes de url entry by its id and returns the deleted URL
+// UpdateCheckByID updates the check results for the url by its id and returns the updated URL
+func (r *Repo) UpdateCheckByID(ctx context.Context, id int, status string, code *int, failed bool) (model.URL, error) {
+	var URL model.URL
+	checkedAt := time.Now()
+	query := `UPDATE "urls"
+			  SET "check_status" = $1, "check_code" = $2, "checked_at" = $3,
+			      "check_failures" = CASE WHEN $4 THEN "check_failures" + 1 ELSE 0 END
+			  WHERE "id" = $5
+			  RETURNING *;`
+	err := pgxutil.SelectStruct(ctx, r.conn, &URL, query, status, code, checkedAt, failed, id)
+	if err != nil {
+		switch {
+		case rErrNoRows.MatchString(err.Error()):
+			return URL, ErrNoRows
+		case rErrIntegrityViolation.MatchString(err.Error()):
+			return URL, ErrIntegrityViolation
+		}
+	}
+	return URL, err
+}
+
+// ClaimForCheck marks as checked at most limit urls not checked since checkedBefore and returns them.
+// Claimed rows are skipped by other instances, so each url is checked only once.
+func (r *Repo) ClaimForCheck(ctx context.Context, checkedBefore time.Time, limit int) ([]model.URL, error) {
+	var URLs []model.URL
+	checkedAt := time.Now()
+	query := `UPDATE "urls"
+			  SET "checked_at" = $1
+			  WHERE "id" IN (
+				  SELECT "id" FROM "urls"
+				  WHERE ("checked_at" IS NULL OR "checked_at" < $2) AND "deleted_at" IS NULL
+				  ORDER BY "checked_at" NULLS FIRST
+				  LIMIT $3
+				  FOR UPDATE SKIP LOCKED
+			  )
+			  RETURNING *;`
+	err := pgxutil.SelectAllStruct(ctx, r.conn, &URLs, query, checkedAt, checkedBefore, limit)
+	return URLs, err
+}
+
+// ListFilter describes the optional filters when listing urls
+type ListFilter struct {
+	CheckStatus      *string
+	MinCheckFailures int
+	Deleted          bool
+}
+
+// List retrieves the urls matching the filter, ordered by id
+func (r *Repo) List(ctx context.Context, filter ListFilter, limit int, offset int) ([]model.URL, error) {
+	URLs := []model.URL{}
+	query := `SELECT * FROM "urls"
+			  WHERE ($1::VARCHAR IS NULL OR "check_status" = $1)
+			  AND "check_failures" >= $2
+			  AND ("deleted_at" IS NOT NULL) = $3
+			  ORDER BY "id"
+			  LIMIT $4 OFFSET $5;`
+	err := pgxutil.SelectAllStruct(ctx, r.conn, &URLs, query, filter.CheckStatus, filter.MinCheckFailures, filter.Deleted, limit, offset)
+	return URLs, err
+}
+
+// DeleteByID moves the url by its id to the trash and returns the deleted URL
 func (r *Repo) DeleteByID(ctx context.Context, id int) (model.URL, error) {
 	var URL model.URL
-	query := `DELETE FROM "urls"
-			  WHERE "id" = $1
+	deletedAt := time.Now()
+	query := `UPDATE "urls"
+			  SET "deleted_at" = $1, "dedup_key" = NULL
+			  WHERE "id" = $2 AND "deleted_at" IS NULL
 			  RETURNING *;`
-	err := pgxutil.SelectStruct(ctx, r.conn, &URL, query, id)
+	err := pgxutil.SelectStruct(ctx, r.conn, &URL, query, deletedAt, id)
 	if err != nil {
 		switch {
 		case rErrNoRows.MatchString(err.Error()):
@@ -248,13 +441,14 @@ func (r *Repo) DeleteByID(ctx context.Context, id int) (model.URL, error) {
 	return URL, err
 }
 
-// DeleteByName deletes de url entry by its name and returns the deleted URL
-func (r *Repo) DeleteByName(ctx context.Context, name string) (model.URL, error) {
+// RestoreByName takes the url by its name out of the trash, if it was deleted after the given time, and returns the restored URL
+func (r *Repo) RestoreByName(ctx context.Context, name string, deletedAfter time.Time) (model.URL, error) {
 	var URL model.URL
-	query := `DELETE FROM "urls"
-			  WHERE "name" = $1
+	query := `UPDATE "urls"
+			  SET "deleted_at" = NULL
+			  WHERE "name" = $1 AND "deleted_at" > $2
 			  RETURNING *;`
-	err := pgxutil.SelectStruct(ctx, r.conn, &URL, query, name)
+	err := pgxutil.SelectStruct(ctx, r.conn, &URL, query, name, deletedAfter)
 	if err != nil {
 		switch {
 		case rErrNoRows.MatchString(err.Error()):
@@ -266,6 +460,16 @@ func (r *Repo) DeleteByName(ctx context.Context, name string) (model.URL, error)
 	return URL, err
 }
 
+// PurgeDeleted permanently deletes the urls deleted before the given time and returns the purged URLs
+func (r *Repo) PurgeDeleted(ctx context.Context, deletedBefore time.Time) ([]model.URL, error) {
+	URLs := []model.URL{}
+	query := `DELETE FROM "urls"
+			  WHERE "deleted_at" < $1
+			  RETURNING *;`
+	err := pgxutil.SelectAllStruct(ctx, r.conn, &URLs, query, deletedBefore)
+	return URLs, err
+}
+
 // Health checks the database connection health
 func (r Repo) Health() error {
 	if _, err := r.db.Exec(context.Background(), ";"); err != nil {
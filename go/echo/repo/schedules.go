@@ -0,0 +1,113 @@
+package repo
+
+import (
+	"context"
+	"shortr/model"
+	"time"
+
+	"github.com/jackc/pgxutil"
+)
+
+// CreateSchedule creates a new scheduled destination change of an url and returns the new Schedule
+func (r *Repo) CreateSchedule(ctx context.Context, schedule model.Schedule) (model.Schedule, error) {
+	var Schedule model.Schedule
+	createdAt := time.Now()
+	query := `INSERT INTO "schedules" ("url_id", "url", "expanded_url", "effective_from", "created_at")
+			  VALUES ($1, $2, $3, $4, $5)
+			  RETURNING *;`
+	err := pgxutil.SelectStruct(ctx, r.conn, &Schedule, query, schedule.URLID, schedule.URL, schedule.ExpandedURL, schedule.EffectiveFrom, createdAt)
+	if err != nil {
+		switch {
+		case rErrNoRows.MatchString(err.Error()):
+			return Schedule, ErrNoRows
+		case rErrIntegrityViolation.MatchString(err.Error()):
+			return Schedule, ErrIntegrityViolation
+		}
+	}
+	return Schedule, err
+}
+
+// GetSchedulesByURLID retrieves the scheduled destination changes of the url by its id, ordered by effective time
+func (r *Repo) GetSchedulesByURLID(ctx context.Context, urlID int) ([]model.Schedule, error) {
+	Schedules := []model.Schedule{}
+	query := `SELECT * FROM "schedules"
+			  WHERE "url_id" = $1
+			  ORDER BY "effective_from", "id";`
+	err := pgxutil.SelectAllStruct(ctx, r.conn, &Schedules, query, urlID)
+	return Schedules, err
+}
+
+// DeletePendingScheduleByID deletes the not yet applied schedule of the url by its id and returns the deleted Schedule
+func (r *Repo) DeletePendingScheduleByID(ctx context.Context, urlID int, id int) (model.Schedule, error) {
+	var Schedule model.Schedule
+	query := `DELETE FROM "schedules"
+			  WHERE "id" = $1 AND "url_id" = $2 AND "applied_at" IS NULL
+			  RETURNING *;`
+	err := pgxutil.SelectStruct(ctx, r.conn, &Schedule, query, id, urlID)
+	if err != nil {
+		switch {
+		case rErrNoRows.MatchString(err.Error()):
+			return Schedule, ErrNoRows
+		case rErrIntegrityViolation.MatchString(err.Error()):
+			return Schedule, ErrIntegrityViolation
+		}
+	}
+	return Schedule, err
+}
+
+// ClaimDueSchedules locks up to limit not yet applied schedules effective before the given time, ordered by effective time.
+// Locked schedules are skipped, so it must be run in a transaction to keep them claimed until applied.
+func (r *Repo) ClaimDueSchedules(ctx context.Context, effectiveBefore time.Time, limit int) ([]model.Schedule, error) {
+	var Schedules []model.Schedule
+	query := `SELECT * FROM "schedules"
+			  WHERE "applied_at" IS NULL AND "effective_from" <= $1
+			  AND "url_id" IN (SELECT "id" FROM "urls" WHERE "deleted_at" IS NULL)
+			  ORDER BY "effective_from", "id"
+			  LIMIT $2
+			  FOR UPDATE SKIP LOCKED;`
+	err := pgxutil.SelectAllStruct(ctx, r.conn, &Schedules, query, effectiveBefore, limit)
+	return Schedules, err
+}
+
+// UpdateScheduleAppliedByID marks the schedule by its id as applied and returns the updated Schedule
+func (r *Repo) UpdateScheduleAppliedByID(ctx context.Context, id int) (model.Schedule, error) {
+	var Schedule model.Schedule
+	appliedAt := time.Now()
+	query := `UPDATE "schedules"
+			  SET "applied_at" = $1
+			  WHERE "id" = $2
+			  RETURNING *;`
+	err := pgxutil.SelectStruct(ctx, r.conn, &Schedule, query, appliedAt, id)
+	if err != nil {
+		switch {
+		case rErrNoRows.MatchString(err.Error()):
+			return Schedule, ErrNoRows
+		case rErrIntegrityViolation.MatchString(err.Error()):
+			return Schedule, ErrIntegrityViolation
+		}
+	}
+	return Schedule, err
+}
+
+// GetNamesAppliedSince retrieves the names of the urls with schedules applied after the given time
+func (r *Repo) GetNamesAppliedSince(ctx context.Context, appliedAfter time.Time) ([]string, error) {
+	names := []string{}
+	query := `SELECT DISTINCT "urls"."name" FROM "schedules"
+			  JOIN "urls" ON "urls"."id" = "schedules"."url_id"
+			  WHERE "schedules"."applied_at" > $1;`
+	rows, err := r.conn.Query(ctx, query, appliedAfter)
+	if err != nil {
+		return names, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return names, err
+		}
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
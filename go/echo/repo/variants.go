@@ -0,0 +1,42 @@
+package repo
+
+import (
+	"context"
+	"time"
+)
+
+// AddVariantHit counts a hit of the url by its id for the day sent to the variant
+func (r *Repo) AddVariantHit(ctx context.Context, urlID int, day time.Time, variant string) error {
+	query := `INSERT INTO "variant_hits" ("url_id", "day", "variant", "hits")
+			  VALUES ($1, $2, $3, 1)
+			  ON CONFLICT ("url_id", "day", "variant") DO UPDATE
+			  SET "hits" = "variant_hits"."hits" + 1;`
+	_, err := r.conn.Exec(ctx, query, urlID, day, variant)
+	return err
+}
+
+// CountVariantHits counts the hits of the url by its id between from and to, both included, for each variant
+func (r *Repo) CountVariantHits(ctx context.Context, urlID int, from *time.Time, to *time.Time) (map[string]int, error) {
+	counts := map[string]int{}
+	query := `SELECT "variant", SUM("hits") FROM "variant_hits"
+			  WHERE "url_id" = $1
+			  AND ($2::DATE IS NULL OR "day" >= $2)
+			  AND ($3::DATE IS NULL OR "day" <= $3)
+			  GROUP BY "variant";`
+	rows, err := r.conn.Query(ctx, query, urlID, from, to)
+	if err != nil {
+		return counts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var variant string
+		var count int
+		if err := rows.Scan(&variant, &count); err != nil {
+			return counts, err
+		}
+		counts[variant] = count
+	}
+
+	return counts, rows.Err()
+}
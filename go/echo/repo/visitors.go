@@ -0,0 +1,42 @@
+package repo
+
+import (
+	"context"
+	"time"
+)
+
+// AddVisitor raises the register of the unique visitors sketch of the url by its id for the day to the rank.
+// Registers only grow, so concurrent visits are merged by the database without reading the sketch.
+func (r *Repo) AddVisitor(ctx context.Context, urlID int, day time.Time, registers int, index int, rank uint8) error {
+	query := `INSERT INTO "visitors" ("url_id", "day", "sketch")
+			  VALUES ($1, $2, SET_BYTE(DECODE(REPEAT('00', $3), 'hex'), $4, $5))
+			  ON CONFLICT ("url_id", "day") DO UPDATE
+			  SET "sketch" = SET_BYTE("visitors"."sketch", $4, $5)
+			  WHERE GET_BYTE("visitors"."sketch", $4) < $5;`
+	_, err := r.conn.Exec(ctx, query, urlID, day, registers, index, int(rank))
+	return err
+}
+
+// GetVisitorSketches retrieves the unique visitors sketches of the url by its id for the days between from and to, both included
+func (r *Repo) GetVisitorSketches(ctx context.Context, urlID int, from *time.Time, to *time.Time) ([][]byte, error) {
+	sketches := [][]byte{}
+	query := `SELECT "sketch" FROM "visitors"
+			  WHERE "url_id" = $1
+			  AND ($2::DATE IS NULL OR "day" >= $2)
+			  AND ($3::DATE IS NULL OR "day" <= $3);`
+	rows, err := r.conn.Query(ctx, query, urlID, from, to)
+	if err != nil {
+		return sketches, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sketch []byte
+		if err := rows.Scan(&sketch); err != nil {
+			return sketches, err
+		}
+		sketches = append(sketches, sketch)
+	}
+
+	return sketches, rows.Err()
+}
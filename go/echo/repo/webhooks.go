@@ -0,0 +1,195 @@
+package repo
+
+import (
+	"context"
+	"shortr/model"
+	"time"
+
+	"github.com/jackc/pgxutil"
+)
+
+// CreateWebhook creates a new webhook subscription and returns the new Webhook
+func (r *Repo) CreateWebhook(ctx context.Context, webhook model.Webhook) (model.Webhook, error) {
+	var Webhook model.Webhook
+	createdAt := time.Now()
+	query := `INSERT INTO "webhooks" ("url", "secret", "events", "created_at")
+			  VALUES ($1, $2, $3, $4)
+			  RETURNING *;`
+	err := pgxutil.SelectStruct(ctx, r.conn, &Webhook, query, webhook.URL, webhook.Secret, webhook.Events, createdAt)
+	if err != nil {
+		switch {
+		case rErrNoRows.MatchString(err.Error()):
+			return Webhook, ErrNoRows
+		case rErrIntegrityViolation.MatchString(err.Error()):
+			return Webhook, ErrIntegrityViolation
+		}
+	}
+	return Webhook, err
+}
+
+// GetWebhookByID retrieves the webhook by its id
+func (r *Repo) GetWebhookByID(ctx context.Context, id int) (model.Webhook, error) {
+	var Webhook model.Webhook
+	query := `SELECT * FROM "webhooks"
+			  WHERE "id" = $1;`
+	err := pgxutil.SelectStruct(ctx, r.conn, &Webhook, query, id)
+	if err != nil {
+		switch {
+		case rErrNoRows.MatchString(err.Error()):
+			return Webhook, ErrNoRows
+		case rErrIntegrityViolation.MatchString(err.Error()):
+			return Webhook, ErrIntegrityViolation
+		}
+	}
+	return Webhook, err
+}
+
+// ListWebhooks retrieves the webhooks, ordered by id
+func (r *Repo) ListWebhooks(ctx context.Context) ([]model.Webhook, error) {
+	Webhooks := []model.Webhook{}
+	query := `SELECT * FROM "webhooks"
+			  ORDER BY "id";`
+	err := pgxutil.SelectAllStruct(ctx, r.conn, &Webhooks, query)
+	return Webhooks, err
+}
+
+// DeleteWebhookByID deletes the webhook by its id along with its deliveries and returns the deleted Webhook
+func (r *Repo) DeleteWebhookByID(ctx context.Context, id int) (model.Webhook, error) {
+	var Webhook model.Webhook
+	query := `DELETE FROM "webhooks"
+			  WHERE "id" = $1
+			  RETURNING *;`
+	err := pgxutil.SelectStruct(ctx, r.conn, &Webhook, query, id)
+	if err != nil {
+		switch {
+		case rErrNoRows.MatchString(err.Error()):
+			return Webhook, ErrNoRows
+		case rErrIntegrityViolation.MatchString(err.Error()):
+			return Webhook, ErrIntegrityViolation
+		}
+	}
+	return Webhook, err
+}
+
+// EnqueueDeliveries queues a delivery of the payload for every webhook subscribed to the event
+func (r *Repo) EnqueueDeliveries(ctx context.Context, event string, payload []byte) error {
+	createdAt := time.Now()
+	query := `INSERT INTO "deliveries" ("webhook_id", "event", "payload", "next_attempt_at", "created_at")
+			  SELECT "id", $1, $2, $3, $3 FROM "webhooks"
+			  WHERE $1 = ANY("events");`
+	_, err := r.conn.Exec(ctx, query, event, string(payload), createdAt)
+	return err
+}
+
+// ClaimDueDeliveries leases up to limit pending deliveries due before the given time, ordered by due time.
+// Their next attempt is postponed until the lease ends, so other instances skip them meanwhile.
+func (r *Repo) ClaimDueDeliveries(ctx context.Context, dueBefore time.Time, lease time.Duration, limit int) ([]model.Delivery, error) {
+	var Deliveries []model.Delivery
+	query := `UPDATE "deliveries"
+			  SET "next_attempt_at" = $1
+			  WHERE "id" IN (
+				  SELECT "id" FROM "deliveries"
+				  WHERE "status" = 'pending' AND "next_attempt_at" <= $2
+				  ORDER BY "next_attempt_at"
+				  LIMIT $3
+				  FOR UPDATE SKIP LOCKED
+			  )
+			  RETURNING *;`
+	err := pgxutil.SelectAllStruct(ctx, r.conn, &Deliveries, query, dueBefore.Add(lease), dueBefore, limit)
+	return Deliveries, err
+}
+
+// RecordAttempt logs the attempt of the delivery and updates the delivery with its outcome, that is its status and,
+// while it is pending, the time of its next attempt. It returns the updated Delivery.
+func (r *Repo) RecordAttempt(ctx context.Context, attempt model.Attempt, status string, nextAttemptAt time.Time) (model.Delivery, error) {
+	var Delivery model.Delivery
+	query := `WITH "attempt" AS (
+				  INSERT INTO "delivery_attempts" ("delivery_id", "attempted_at", "code", "error", "duration")
+				  VALUES ($1, $2, $3, $4, $5)
+			  )
+			  UPDATE "deliveries"
+			  SET "status" = $6, "attempts" = "attempts" + 1, "next_attempt_at" = $7,
+				  "finished_at" = CASE WHEN $6 = 'pending' THEN NULL ELSE NOW() END
+			  WHERE "id" = $1
+			  RETURNING *;`
+	err := pgxutil.SelectStruct(ctx, r.conn, &Delivery, query, attempt.DeliveryID, attempt.AttemptedAt, attempt.Code, attempt.Error,
+		attempt.Duration, status, nextAttemptAt)
+	if err != nil {
+		switch {
+		case rErrNoRows.MatchString(err.Error()):
+			return Delivery, ErrNoRows
+		case rErrIntegrityViolation.MatchString(err.Error()):
+			return Delivery, ErrIntegrityViolation
+		}
+	}
+	return Delivery, err
+}
+
+// GetDeliveriesByWebhookID retrieves the deliveries of the webhook by its id, optionally only those in the status,
+// newest first
+func (r *Repo) GetDeliveriesByWebhookID(ctx context.Context, webhookID int, status *string, limit int, offset int) ([]model.Delivery, error) {
+	Deliveries := []model.Delivery{}
+	query := `SELECT * FROM "deliveries"
+			  WHERE "webhook_id" = $1
+			  AND ($2::VARCHAR IS NULL OR "status" = $2)
+			  ORDER BY "id" DESC
+			  LIMIT $3 OFFSET $4;`
+	err := pgxutil.SelectAllStruct(ctx, r.conn, &Deliveries, query, webhookID, status, limit, offset)
+	return Deliveries, err
+}
+
+// GetDeliveryByID retrieves the delivery of the webhook by its id
+func (r *Repo) GetDeliveryByID(ctx context.Context, webhookID int, id int64) (model.Delivery, error) {
+	var Delivery model.Delivery
+	query := `SELECT * FROM "deliveries"
+			  WHERE "id" = $1 AND "webhook_id" = $2;`
+	err := pgxutil.SelectStruct(ctx, r.conn, &Delivery, query, id, webhookID)
+	if err != nil {
+		switch {
+		case rErrNoRows.MatchString(err.Error()):
+			return Delivery, ErrNoRows
+		case rErrIntegrityViolation.MatchString(err.Error()):
+			return Delivery, ErrIntegrityViolation
+		}
+	}
+	return Delivery, err
+}
+
+// GetAttemptsByDeliveryID retrieves the attempts of the delivery by its id, in order
+func (r *Repo) GetAttemptsByDeliveryID(ctx context.Context, deliveryID int64) ([]model.Attempt, error) {
+	Attempts := []model.Attempt{}
+	query := `SELECT * FROM "delivery_attempts"
+			  WHERE "delivery_id" = $1
+			  ORDER BY "id";`
+	err := pgxutil.SelectAllStruct(ctx, r.conn, &Attempts, query, deliveryID)
+	return Attempts, err
+}
+
+// RetryDeadDeliveryByID queues the dead delivery of the webhook by its id again, with a fresh attempts count,
+// and returns the updated Delivery
+func (r *Repo) RetryDeadDeliveryByID(ctx context.Context, webhookID int, id int64) (model.Delivery, error) {
+	var Delivery model.Delivery
+	nextAttemptAt := time.Now()
+	query := `UPDATE "deliveries"
+			  SET "status" = 'pending', "attempts" = 0, "next_attempt_at" = $1, "finished_at" = NULL
+			  WHERE "id" = $2 AND "webhook_id" = $3 AND "status" = 'dead'
+			  RETURNING *;`
+	err := pgxutil.SelectStruct(ctx, r.conn, &Delivery, query, nextAttemptAt, id, webhookID)
+	if err != nil {
+		switch {
+		case rErrNoRows.MatchString(err.Error()):
+			return Delivery, ErrNoRows
+		case rErrIntegrityViolation.MatchString(err.Error()):
+			return Delivery, ErrIntegrityViolation
+		}
+	}
+	return Delivery, err
+}
+
+// PurgeFinishedDeliveries deletes the delivered and dead deliveries finished before the given time, along with their attempts
+func (r *Repo) PurgeFinishedDeliveries(ctx context.Context, finishedBefore time.Time) error {
+	query := `DELETE FROM "deliveries"
+			  WHERE "finished_at" < $1;`
+	_, err := r.conn.Exec(ctx, query, finishedBefore)
+	return err
+}
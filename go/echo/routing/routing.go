@@ -0,0 +1,190 @@
+package routing
+
+import (
+	"errors"
+	"math/rand"
+	"shortr/model"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+var ErrInvalidCountry = errors.New("invalid rule country")
+var ErrInvalidLanguage = errors.New("invalid rule language")
+var ErrInvalidVariantName = errors.New("invalid variant name")
+var ErrDuplicatedVariantName = errors.New("duplicated variant name")
+var ErrInvalidVariantWeight = errors.New("invalid variant weight")
+
+var random = rand.New(rand.NewSource(time.Now().UnixNano()))
+var randomMutex sync.Mutex
+
+// Tag of the Accept-Language wildcard, which accepts any language
+var wildcard = language.Make("mul")
+
+// Visitor describes who is being redirected
+type Visitor struct {
+	Country   string
+	Languages []language.Tag // Sorted by preference
+}
+
+// NewVisitor creates a new Visitor instance from its country code and Accept-Language header
+func NewVisitor(country string, acceptLanguage string) Visitor {
+	visitor := Visitor{
+		Country:   strings.ToUpper(country),
+		Languages: []language.Tag{},
+	}
+
+	// Tags are sorted by weight, languages with no weight are not accepted
+	tags, weights, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil {
+		return visitor
+	}
+	for i, tag := range tags {
+		if weights[i] > 0 && tag != language.Und && tag != wildcard {
+			visitor.Languages = append(visitor.Languages, tag)
+		}
+	}
+
+	return visitor
+}
+
+// Match returns the url of the first rule the Visitor satisfies, if any, trying the languages of the Visitor
+// in order of preference, so a rule for a less preferred language only matches when no rule matches a preferred one.
+// Empty conditions are always satisfied, and languages without region match every region.
+func Match(rules []model.Rule, visitor Visitor) (string, bool) {
+	if len(visitor.Languages) == 0 {
+		return match(rules, visitor.Country, nil)
+	}
+
+	for _, lang := range visitor.Languages {
+		if url, matches := match(rules, visitor.Country, &lang); matches {
+			return url, true
+		}
+	}
+
+	return "", false
+}
+
+// Normalize validates the conditions of the rule and returns them in canonical form
+func Normalize(rule model.Rule) (model.Rule, error) {
+	normalized := model.Rule{
+		Countries: make([]string, 0, len(rule.Countries)),
+		Languages: make([]string, 0, len(rule.Languages)),
+		URL:       rule.URL,
+	}
+
+	for _, country := range rule.Countries {
+		country = strings.ToUpper(strings.TrimSpace(country))
+		region, err := language.ParseRegion(country)
+		if err != nil || len(country) != 2 || !region.IsCountry() {
+			return rule, ErrInvalidCountry
+		}
+		normalized.Countries = append(normalized.Countries, country)
+	}
+
+	for _, lang := range rule.Languages {
+		tag, err := language.Parse(strings.TrimSpace(lang))
+		if err != nil {
+			return rule, ErrInvalidLanguage
+		}
+		normalized.Languages = append(normalized.Languages, tag.String())
+	}
+
+	return normalized, nil
+}
+
+// Pick chooses one of the variants randomly, proportionally to their weights
+func Pick(variants []model.Variant) (model.Variant, bool) {
+	total := 0
+	for _, variant := range variants {
+		total += variant.Weight
+	}
+
+	if total <= 0 {
+		return model.Variant{}, false
+	}
+
+	randomMutex.Lock()
+	target := random.Intn(total)
+	randomMutex.Unlock()
+
+	for _, variant := range variants {
+		target -= variant.Weight
+		if target < 0 {
+			return variant, true
+		}
+	}
+
+	return model.Variant{}, false
+}
+
+// Find gets the variant by its name
+func Find(variants []model.Variant, name string) (model.Variant, bool) {
+	for _, variant := range variants {
+		if variant.Name == name {
+			return variant, true
+		}
+	}
+	return model.Variant{}, false
+}
+
+// ValidateVariants checks that variant names are unique and weights are not negative, with at least one positive
+func ValidateVariants(variants []model.Variant) error {
+	names := make(map[string]bool, len(variants))
+	total := 0
+
+	for _, variant := range variants {
+		if variant.Name == "" || len(variant.Name) > 100 {
+			return ErrInvalidVariantName
+		}
+		if names[variant.Name] {
+			return ErrDuplicatedVariantName
+		}
+		names[variant.Name] = true
+
+		if variant.Weight < 0 {
+			return ErrInvalidVariantWeight
+		}
+		total += variant.Weight
+	}
+
+	if len(variants) > 0 && total == 0 {
+		return ErrInvalidVariantWeight
+	}
+
+	return nil
+}
+
+func match(rules []model.Rule, country string, lang *language.Tag) (string, bool) {
+	var tag, base string
+	if lang != nil {
+		tag = lang.String()
+		// Bases of tags without a language, like und-CH, are guessed
+		if b, confidence := lang.Base(); confidence == language.Exact {
+			base = b.String()
+		}
+	}
+
+	for _, rule := range rules {
+		if len(rule.Countries) > 0 && !contains(rule.Countries, country) {
+			continue
+		}
+		if len(rule.Languages) > 0 && (lang == nil || !contains(rule.Languages, tag) && !contains(rule.Languages, base)) {
+			continue
+		}
+		return rule.URL, true
+	}
+
+	return "", false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
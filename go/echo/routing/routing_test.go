@@ -0,0 +1,165 @@
+package routing
+
+import (
+	"shortr/model"
+	"testing"
+)
+
+func TestNewVisitor(t *testing.T) {
+	tests := []struct {
+		country        string
+		acceptLanguage string
+		wantCountry    string
+		wantLanguages  []string
+	}{
+		{"us", "en-US,en;q=0.9", "US", []string{"en-US", "en"}},
+		{"CH", "en;q=0.5, fr-CH", "CH", []string{"fr-CH", "en"}},
+		{"", "de, fr;q=0", "", []string{"de"}},
+		{"", "*", "", []string{}},
+		{"", "", "", []string{}},
+		{"", "not a language!", "", []string{}},
+	}
+
+	for _, test := range tests {
+		visitor := NewVisitor(test.country, test.acceptLanguage)
+		if visitor.Country != test.wantCountry {
+			t.Errorf("NewVisitor(%q, %q).Country = %q, want %q", test.country, test.acceptLanguage, visitor.Country, test.wantCountry)
+		}
+		languages := make([]string, 0, len(visitor.Languages))
+		for _, tag := range visitor.Languages {
+			languages = append(languages, tag.String())
+		}
+		if !equal(languages, test.wantLanguages) {
+			t.Errorf("NewVisitor(%q, %q).Languages = %v, want %v", test.country, test.acceptLanguage, languages, test.wantLanguages)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	rules := []model.Rule{
+		{Countries: []string{"US"}, Languages: []string{"es"}, URL: "us-es"},
+		{Languages: []string{"en-GB"}, URL: "en-gb"},
+		{Languages: []string{"en"}, URL: "en"},
+		{Languages: []string{"de"}, URL: "de"},
+		{Countries: []string{"FR", "BE"}, URL: "fr-be"},
+	}
+
+	tests := []struct {
+		country        string
+		acceptLanguage string
+		want           string
+		matches        bool
+	}{
+		{"US", "es-MX", "us-es", true},
+		{"MX", "es-MX", "", false},
+		{"GB", "en-GB", "en-gb", true},
+		{"US", "en-US", "en", true},
+		{"CH", "fr-CH, en;q=0.9", "en", true},
+		{"CH", "en;q=0.5, de;q=0.8", "de", true},
+		{"CH", "it, de;q=0", "", false},
+		{"BE", "nl-BE", "fr-be", true},
+		{"FR", "", "fr-be", true},
+		{"", "", "", false},
+	}
+
+	for _, test := range tests {
+		got, matches := Match(rules, NewVisitor(test.country, test.acceptLanguage))
+		if got != test.want || matches != test.matches {
+			t.Errorf("Match(%q, %q) = %q, %v, want %q, %v", test.country, test.acceptLanguage, got, matches, test.want, test.matches)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		rule          model.Rule
+		wantCountries []string
+		wantLanguages []string
+		err           error
+	}{
+		{model.Rule{Countries: []string{" us", "gb"}, Languages: []string{"EN-us", "fr"}}, []string{"US", "GB"}, []string{"en-US", "fr"}, nil},
+		{model.Rule{}, []string{}, []string{}, nil},
+		{model.Rule{Countries: []string{"USA"}}, nil, nil, ErrInvalidCountry},
+		{model.Rule{Countries: []string{"EU"}}, nil, nil, ErrInvalidCountry},
+		{model.Rule{Languages: []string{"not a language!"}}, nil, nil, ErrInvalidLanguage},
+	}
+
+	for _, test := range tests {
+		normalized, err := Normalize(test.rule)
+		if err != test.err {
+			t.Errorf("Normalize(%v) error = %v, want %v", test.rule, err, test.err)
+			continue
+		}
+		if err == nil && (!equal(normalized.Countries, test.wantCountries) || !equal(normalized.Languages, test.wantLanguages)) {
+			t.Errorf("Normalize(%v) = %v, want countries %v and languages %v", test.rule, normalized, test.wantCountries, test.wantLanguages)
+		}
+	}
+}
+
+func TestPick(t *testing.T) {
+	if _, exists := Pick(nil); exists {
+		t.Error("Pick of no variants picked one")
+	}
+	if _, exists := Pick([]model.Variant{{Name: "a", Weight: 0}}); exists {
+		t.Error("Pick of variants without weight picked one")
+	}
+
+	variants := []model.Variant{{Name: "a", Weight: 3}, {Name: "retired", Weight: 0}, {Name: "b", Weight: 1}}
+	picks := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		variant, exists := Pick(variants)
+		if !exists {
+			t.Fatal("Pick of weighted variants picked none")
+		}
+		picks[variant.Name]++
+	}
+	if picks["retired"] != 0 {
+		t.Errorf("Pick chose a variant without weight %d times", picks["retired"])
+	}
+	if picks["a"] < 2700 || picks["a"] > 3300 {
+		t.Errorf("Pick chose the variant with 3/4 of the weight %d times out of 4000", picks["a"])
+	}
+}
+
+func TestFind(t *testing.T) {
+	variants := []model.Variant{{Name: "a", URL: "https://a.com"}, {Name: "b", URL: "https://b.com"}}
+
+	if variant, exists := Find(variants, "b"); !exists || variant.URL != "https://b.com" {
+		t.Errorf("Find(b) = %v, %v", variant, exists)
+	}
+	if _, exists := Find(variants, "c"); exists {
+		t.Error("Find(c) found a variant")
+	}
+}
+
+func TestValidateVariants(t *testing.T) {
+	tests := []struct {
+		variants []model.Variant
+		err      error
+	}{
+		{nil, nil},
+		{[]model.Variant{{Name: "a", Weight: 1}, {Name: "b", Weight: 0}}, nil},
+		{[]model.Variant{{Name: "", Weight: 1}}, ErrInvalidVariantName},
+		{[]model.Variant{{Name: "a", Weight: 1}, {Name: "a", Weight: 1}}, ErrDuplicatedVariantName},
+		{[]model.Variant{{Name: "a", Weight: -1}}, ErrInvalidVariantWeight},
+		{[]model.Variant{{Name: "a", Weight: 0}}, ErrInvalidVariantWeight},
+	}
+
+	for _, test := range tests {
+		if err := ValidateVariants(test.variants); err != test.err {
+			t.Errorf("ValidateVariants(%v) = %v, want %v", test.variants, err, test.err)
+		}
+	}
+}
+
+func equal(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
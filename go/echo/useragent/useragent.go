@@ -0,0 +1,116 @@
+package useragent
+
+import (
+	"strings"
+)
+
+const (
+	OSiOS      = "ios"
+	OSAndroid  = "android"
+	OSWindows  = "windows"
+	OSMacOS    = "macos"
+	OSLinux    = "linux"
+	OSChromeOS = "chromeos"
+	OSOther    = "other"
+)
+
+const (
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceDesktop = "desktop"
+	DeviceOther   = "other"
+)
+
+const (
+	BrowserChrome  = "chrome"
+	BrowserSafari  = "safari"
+	BrowserFirefox = "firefox"
+	BrowserEdge    = "edge"
+	BrowserOpera   = "opera"
+	BrowserSamsung = "samsung"
+	BrowserIE      = "ie"
+	BrowserOther   = "other"
+)
+
+const (
+	PlatformIOS     = "ios"
+	PlatformAndroid = "android"
+	PlatformDesktop = "desktop"
+)
+
+// Agent describes the classification of a user agent
+type Agent struct {
+	Browser string
+	OS      string
+	Device  string
+}
+
+// Platform gets the platform of the Agent destinations are chosen by, or an empty string if there is none
+func (a Agent) Platform() string {
+	switch {
+	case a.OS == OSiOS:
+		return PlatformIOS
+	case a.OS == OSAndroid:
+		return PlatformAndroid
+	case a.Device == DeviceDesktop:
+		return PlatformDesktop
+	default:
+		return ""
+	}
+}
+
+// Parse classifies the user agent by its browser, operating system and device type
+func Parse(ua string) Agent {
+	ua = strings.ToLower(ua)
+	agent := Agent{Browser: browser(ua), OS: OSOther, Device: DeviceOther}
+
+	// Order matters, as many user agents mention other platforms for compatibility
+	switch {
+	case strings.Contains(ua, "iphone") || strings.Contains(ua, "ipod"):
+		agent.OS, agent.Device = OSiOS, DeviceMobile
+	case strings.Contains(ua, "ipad"):
+		agent.OS, agent.Device = OSiOS, DeviceTablet
+	case strings.Contains(ua, "android"):
+		agent.OS = OSAndroid
+		// Android tablets do not send the mobile token
+		if strings.Contains(ua, "mobile") {
+			agent.Device = DeviceMobile
+		} else {
+			agent.Device = DeviceTablet
+		}
+	case strings.Contains(ua, "windows phone"):
+		agent.Device = DeviceMobile
+	case strings.Contains(ua, "windows"):
+		agent.OS, agent.Device = OSWindows, DeviceDesktop
+	case strings.Contains(ua, "cros"):
+		agent.OS, agent.Device = OSChromeOS, DeviceDesktop
+	case strings.Contains(ua, "macintosh") || strings.Contains(ua, "mac os x"):
+		agent.OS, agent.Device = OSMacOS, DeviceDesktop
+	case strings.Contains(ua, "linux") || strings.Contains(ua, "x11"):
+		agent.OS, agent.Device = OSLinux, DeviceDesktop
+	}
+
+	return agent
+}
+
+func browser(ua string) string {
+	// Order matters, as browsers mention the engines they are based on, and iOS browsers are all Safari based
+	switch {
+	case strings.Contains(ua, "edg/") || strings.Contains(ua, "edga/") || strings.Contains(ua, "edgios/") || strings.Contains(ua, "edge/"):
+		return BrowserEdge
+	case strings.Contains(ua, "opr/") || strings.Contains(ua, "opera") || strings.Contains(ua, "opt/"):
+		return BrowserOpera
+	case strings.Contains(ua, "samsungbrowser/"):
+		return BrowserSamsung
+	case strings.Contains(ua, "firefox/") || strings.Contains(ua, "fxios/"):
+		return BrowserFirefox
+	case strings.Contains(ua, "chrome/") || strings.Contains(ua, "crios/") || strings.Contains(ua, "chromium/"):
+		return BrowserChrome
+	case strings.Contains(ua, "safari/") && strings.Contains(ua, "version/"):
+		return BrowserSafari
+	case strings.Contains(ua, "msie") || strings.Contains(ua, "trident/"):
+		return BrowserIE
+	default:
+		return BrowserOther
+	}
+}
@@ -0,0 +1,70 @@
+package useragent
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		ua       string
+		want     Agent
+		platform string
+	}{
+		{
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1",
+			Agent{Browser: BrowserSafari, OS: OSiOS, Device: DeviceMobile}, PlatformIOS,
+		},
+		{
+			"Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/117.0.5938.108 Mobile/15E148 Safari/604.1",
+			Agent{Browser: BrowserChrome, OS: OSiOS, Device: DeviceTablet}, PlatformIOS,
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 13; Pixel 7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/117.0.0.0 Mobile Safari/537.36",
+			Agent{Browser: BrowserChrome, OS: OSAndroid, Device: DeviceMobile}, PlatformAndroid,
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/22.0 Chrome/111.0.5563.116 Safari/537.36",
+			Agent{Browser: BrowserSamsung, OS: OSAndroid, Device: DeviceTablet}, PlatformAndroid,
+		},
+		{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/117.0.0.0 Safari/537.36 Edg/117.0.2045.47",
+			Agent{Browser: BrowserEdge, OS: OSWindows, Device: DeviceDesktop}, PlatformDesktop,
+		},
+		{
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Safari/605.1.15",
+			Agent{Browser: BrowserSafari, OS: OSMacOS, Device: DeviceDesktop}, PlatformDesktop,
+		},
+		{
+			"Mozilla/5.0 (X11; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/118.0",
+			Agent{Browser: BrowserFirefox, OS: OSLinux, Device: DeviceDesktop}, PlatformDesktop,
+		},
+		{
+			"Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/117.0.0.0 Safari/537.36 OPR/102.0.0.0",
+			Agent{Browser: BrowserOpera, OS: OSChromeOS, Device: DeviceDesktop}, PlatformDesktop,
+		},
+		{
+			"Mozilla/5.0 (Windows NT 6.1; Trident/7.0; rv:11.0) like Gecko",
+			Agent{Browser: BrowserIE, OS: OSWindows, Device: DeviceDesktop}, PlatformDesktop,
+		},
+		{
+			"Mozilla/5.0 (Windows Phone 10.0; Android 6.0.1; Microsoft; Lumia 950) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/52.0.2743.116 Mobile Safari/537.36 Edge/15.15063",
+			Agent{Browser: BrowserEdge, OS: OSAndroid, Device: DeviceMobile}, PlatformAndroid,
+		},
+		{
+			"curl/8.1.2",
+			Agent{Browser: BrowserOther, OS: OSOther, Device: DeviceOther}, "",
+		},
+		{
+			"",
+			Agent{Browser: BrowserOther, OS: OSOther, Device: DeviceOther}, "",
+		},
+	}
+
+	for _, test := range tests {
+		agent := Parse(test.ua)
+		if agent != test.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", test.ua, agent, test.want)
+		}
+		if platform := agent.Platform(); platform != test.platform {
+			t.Errorf("Parse(%q).Platform() = %q, want %q", test.ua, platform, test.platform)
+		}
+	}
+}
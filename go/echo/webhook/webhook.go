@@ -0,0 +1,139 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"shortr/audit"
+	"strconv"
+	"time"
+)
+
+const (
+	EventCreated   = "url.created"
+	EventUpdated   = "url.updated"
+	EventDeleted   = "url.deleted"
+	EventExpired   = "url.expired"
+	EventMilestone = "url.milestone"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusDead      = "dead"
+)
+
+var ErrInvalidEvent = errors.New("invalid webhook event")
+
+// Events of the audited actions, actions on schedules are not url events
+var actions = map[string]string{
+	audit.ActionCreate:    EventCreated,
+	audit.ActionUpdate:    EventUpdated,
+	audit.ActionRollback:  EventUpdated,
+	audit.ActionRules:     EventUpdated,
+	audit.ActionPlatforms: EventUpdated,
+	audit.ActionVariants:  EventUpdated,
+	audit.ActionRestore:   EventUpdated,
+	audit.ActionDelete:    EventDeleted,
+	audit.ActionPurge:     EventExpired,
+}
+
+// Payload describes the body of a delivery
+type Payload struct {
+	Event     string          `json:"event"`
+	CreatedAt time.Time       `json:"created_at"`
+	Milestone *int            `json:"milestone,omitempty"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// EventOf gets the event of the audited action, if it is an url event
+func EventOf(action string) (string, bool) {
+	event, exists := actions[action]
+	return event, exists
+}
+
+// ValidateEvents checks that every event is known and that there is at least one
+func ValidateEvents(events []string) error {
+	if len(events) == 0 {
+		return ErrInvalidEvent
+	}
+	for _, event := range events {
+		switch event {
+		case EventCreated, EventUpdated, EventDeleted, EventExpired, EventMilestone:
+		default:
+			return ErrInvalidEvent
+		}
+	}
+	return nil
+}
+
+// Sign computes the signature of the body sent at timestamp, the hex encoded HMAC-SHA256 of "timestamp.body".
+// The timestamp is signed along with the body, so receivers can reject replayed deliveries.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff gets the delay before retrying a delivery which failed attempts times,
+// doubling from base on every attempt up to max
+func Backoff(attempts int, base time.Duration, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		return max
+	}
+	return delay
+}
+
+// Sender posts signed deliveries to webhook urls
+type Sender struct {
+	client *http.Client
+}
+
+// New creates a new Sender instance
+func New(client *http.Client) *Sender {
+	return &Sender{
+		client: client,
+	}
+}
+
+// Send posts the body of the delivery by its id to the url, signed with the secret,
+// and returns the response code, if any. Deliveries fail unless the response code is 2xx.
+func (s *Sender) Send(ctx context.Context, url string, secret string, id int64, event string, body []byte) (*int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Shortr-Webhook/1.0")
+	req.Header.Set("X-Shortr-Event", event)
+	req.Header.Set("X-Shortr-Delivery", strconv.FormatInt(id, 10))
+	req.Header.Set("X-Shortr-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Shortr-Signature", Sign(secret, timestamp, body))
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024)) // Lets the connection be reused
+
+	code := res.StatusCode
+	if code < 200 || code >= 300 {
+		return &code, fmt.Errorf("webhook responded with %d", code)
+	}
+	return &code, nil
+}
@@ -0,0 +1,143 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"shortr/audit"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		secret    string
+		timestamp int64
+		body      string
+		want      string
+	}{
+		{"secret", 1700000000, `{"event":"url.created"}`, "sha256=bbda9a7f5b6c44499f6360d4b20d1aa66adaac82b25fb97c94299c04cf0c0a8b"},
+		{"secret", 1700000001, `{"event":"url.created"}`, "sha256=be126dd9eeb33de2bb78d2e3b4fe2eb66e7dd70ddc67fa2a334f47fa2185f7e7"},
+		{"other", 1700000000, `{"event":"url.created"}`, "sha256=e8a456467819f54cb74e547f24dc5f1d4df53c10bcffa63d1f4b273c6a6a5789"},
+	}
+
+	for _, test := range tests {
+		if got := Sign(test.secret, test.timestamp, []byte(test.body)); got != test.want {
+			t.Errorf("Sign(%q, %d, %q) = %s, want %s", test.secret, test.timestamp, test.body, got, test.want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{5, 8 * time.Minute},
+		{10, time.Hour},
+		{1000, time.Hour},
+	}
+
+	for _, test := range tests {
+		if got := Backoff(test.attempts, 30*time.Second, time.Hour); got != test.want {
+			t.Errorf("Backoff(%d) = %v, want %v", test.attempts, got, test.want)
+		}
+	}
+}
+
+func TestValidateEvents(t *testing.T) {
+	tests := []struct {
+		events []string
+		err    error
+	}{
+		{[]string{EventCreated}, nil},
+		{[]string{EventCreated, EventUpdated, EventDeleted, EventExpired, EventMilestone}, nil},
+		{nil, ErrInvalidEvent},
+		{[]string{}, ErrInvalidEvent},
+		{[]string{EventCreated, "url.visited"}, ErrInvalidEvent},
+	}
+
+	for _, test := range tests {
+		if err := ValidateEvents(test.events); err != test.err {
+			t.Errorf("ValidateEvents(%v) = %v, want %v", test.events, err, test.err)
+		}
+	}
+}
+
+func TestEventOf(t *testing.T) {
+	tests := []struct {
+		action string
+		event  string
+		exists bool
+	}{
+		{audit.ActionCreate, EventCreated, true},
+		{audit.ActionRollback, EventUpdated, true},
+		{audit.ActionRestore, EventUpdated, true},
+		{audit.ActionDelete, EventDeleted, true},
+		{audit.ActionPurge, EventExpired, true},
+		{audit.ActionSchedule, "", false},
+		{audit.ActionUnschedule, "", false},
+	}
+
+	for _, test := range tests {
+		event, exists := EventOf(test.action)
+		if event != test.event || exists != test.exists {
+			t.Errorf("EventOf(%q) = %q, %v, want %q, %v", test.action, event, exists, test.event, test.exists)
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	body := []byte(`{"event":"url.created"}`)
+
+	tests := []struct {
+		code int
+		fail bool
+	}{
+		{http.StatusOK, false},
+		{http.StatusNoContent, false},
+		{http.StatusFound, true},
+		{http.StatusInternalServerError, true},
+	}
+
+	for _, test := range tests {
+		var req *http.Request
+		var received []byte
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			req = r
+			received, _ = io.ReadAll(r.Body)
+			if test.code == http.StatusFound {
+				w.Header().Set("Location", "/elsewhere")
+			}
+			w.WriteHeader(test.code)
+		}))
+
+		client := &http.Client{
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+		code, err := New(client).Send(context.Background(), server.URL, "secret", 42, EventCreated, body)
+		server.Close()
+
+		if (err != nil) != test.fail || code == nil || *code != test.code {
+			t.Errorf("Send to a %d response = %v, %v, want the code and failure %v", test.code, code, err, test.fail)
+			continue
+		}
+		timestamp, _ := strconv.ParseInt(req.Header.Get("X-Shortr-Timestamp"), 10, 64)
+		if req.Method != http.MethodPost || string(received) != string(body) ||
+			req.Header.Get("X-Shortr-Event") != EventCreated || req.Header.Get("X-Shortr-Delivery") != "42" ||
+			req.Header.Get("X-Shortr-Signature") != Sign("secret", timestamp, body) {
+			t.Errorf("Send posted %s with headers %v and body %s", req.Method, req.Header, received)
+		}
+	}
+
+	if _, err := New(http.DefaultClient).Send(context.Background(), "http://127.0.0.1:0", "secret", 1, EventCreated, body); err == nil {
+		t.Error("Send to an unreachable url did not fail")
+	}
+}
@@ -1,13 +1,212 @@
 CREATE SEQUENCE "urls_id_seq";
 
 CREATE TABLE "urls" (
-    "id"            INTEGER PRIMARY KEY DEFAULT NEXTVAL('urls_id_seq'),
-    "name"          VARCHAR(100) UNIQUE NOT NULL DEFAULT CURRVAL('urls_id_seq'),
-    "url"           TEXT NOT NULL,
-    "hits"          INTEGER NOT NULL DEFAULT 0,
-    "last_hit_at"   TIMESTAMP WITH TIME ZONE NULL,
-    "created_at"    TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
-    "modified_at"   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+    "id"                 INTEGER PRIMARY KEY DEFAULT NEXTVAL('urls_id_seq'),
+    "name"               VARCHAR(100) UNIQUE NOT NULL DEFAULT CURRVAL('urls_id_seq'),
+    "url"                TEXT NOT NULL,
+    "hits"               INTEGER NOT NULL DEFAULT 0,
+    "last_hit_at"        TIMESTAMP WITH TIME ZONE NULL,
+    "created_at"         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    "modified_at"        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    "expanded_url"       TEXT NULL,
+    "check_status"       VARCHAR(20) NULL,
+    "check_code"         INTEGER NULL,
+    "checked_at"         TIMESTAMP WITH TIME ZONE NULL,
+    "check_failures"     INTEGER NOT NULL DEFAULT 0,
+    "meta_title"         TEXT NULL,
+    "meta_description"   TEXT NULL,
+    "meta_image"         TEXT NULL,
+    "meta_favicon"       TEXT NULL,
+    "query_mode"         VARCHAR(10) NOT NULL DEFAULT 'drop',
+    "prefix"             BOOLEAN NOT NULL DEFAULT FALSE,
+    "rules"              JSONB NOT NULL DEFAULT '[]',
+    "platforms"          JSONB NOT NULL DEFAULT '{}',
+    "variants"           JSONB NOT NULL DEFAULT '[]',
+    "sticky_variants"    BOOLEAN NOT NULL DEFAULT FALSE,
+    "deleted_at"         TIMESTAMP WITH TIME ZONE NULL,
+    "bot_hits"           INTEGER NOT NULL DEFAULT 0,
+    "dedup_key"          CHAR(64) UNIQUE NULL
 );
 
 CREATE INDEX "name_idx" ON "urls" ("name");
+CREATE INDEX "check_status_idx" ON "urls" ("check_status");
+CREATE INDEX "checked_at_idx" ON "urls" ("checked_at" NULLS FIRST);
+CREATE INDEX "deleted_at_idx" ON "urls" ("deleted_at") WHERE "deleted_at" IS NOT NULL;
+
+CREATE SEQUENCE "clicks_id_seq";
+
+CREATE TABLE "clicks" (
+    "id"           BIGINT PRIMARY KEY DEFAULT NEXTVAL('clicks_id_seq'),
+    "url_id"       INTEGER NOT NULL REFERENCES "urls" ("id") ON DELETE CASCADE,
+    "clicked_at"   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    "os"           VARCHAR(20) NOT NULL,
+    "device"       VARCHAR(20) NOT NULL,
+    "variant"      VARCHAR(100) NULL,
+    "bot"          BOOLEAN NOT NULL DEFAULT FALSE,
+    "referrer"     VARCHAR(253) NULL,
+    "source"       VARCHAR(20) NOT NULL DEFAULT 'direct',
+    "country"      VARCHAR(2) NULL,
+    "region"       VARCHAR(10) NULL,
+    "browser"      VARCHAR(20) NOT NULL DEFAULT 'other'
+);
+
+CREATE INDEX "clicks_url_id_clicked_at_idx" ON "clicks" ("url_id", "clicked_at");
+
+CREATE TABLE "visitors" (
+    "url_id"   INTEGER NOT NULL REFERENCES "urls" ("id") ON DELETE CASCADE,
+    "day"      DATE NOT NULL,
+    "sketch"   BYTEA NOT NULL,
+    PRIMARY KEY ("url_id", "day")
+);
+
+CREATE TABLE "hourly_hits" (
+    "url_id"     INTEGER NOT NULL REFERENCES "urls" ("id") ON DELETE CASCADE,
+    "hour"       TIMESTAMPTZ NOT NULL,
+    "hits"       INTEGER NOT NULL DEFAULT 0,
+    "bot_hits"   INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY ("url_id", "hour")
+);
+
+CREATE TABLE "referrers" (
+    "url_id"   INTEGER NOT NULL REFERENCES "urls" ("id") ON DELETE CASCADE,
+    "day"      DATE NOT NULL,
+    "domain"   VARCHAR(253) NOT NULL,
+    "source"   VARCHAR(20) NOT NULL,
+    "hits"     INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY ("url_id", "day", "domain")
+);
+
+CREATE TABLE "locations" (
+    "url_id"    INTEGER NOT NULL REFERENCES "urls" ("id") ON DELETE CASCADE,
+    "day"       DATE NOT NULL,
+    "country"   VARCHAR(2) NOT NULL,
+    "region"    VARCHAR(10) NOT NULL,
+    "hits"      INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY ("url_id", "day", "country", "region")
+);
+
+CREATE TABLE "variant_hits" (
+    "url_id"    INTEGER NOT NULL REFERENCES "urls" ("id") ON DELETE CASCADE,
+    "day"       DATE NOT NULL,
+    "variant"   VARCHAR(100) NOT NULL,
+    "hits"      INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY ("url_id", "day", "variant")
+);
+
+CREATE TABLE "agents" (
+    "url_id"    INTEGER NOT NULL REFERENCES "urls" ("id") ON DELETE CASCADE,
+    "day"       DATE NOT NULL,
+    "browser"   VARCHAR(20) NOT NULL,
+    "os"        VARCHAR(20) NOT NULL,
+    "device"    VARCHAR(20) NOT NULL,
+    "hits"      INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY ("url_id", "day", "browser", "os", "device")
+);
+
+CREATE SEQUENCE "schedules_id_seq";
+
+CREATE TABLE "schedules" (
+    "id"               INTEGER PRIMARY KEY DEFAULT NEXTVAL('schedules_id_seq'),
+    "url_id"           INTEGER NOT NULL REFERENCES "urls" ("id") ON DELETE CASCADE,
+    "url"              TEXT NOT NULL,
+    "expanded_url"     TEXT NULL,
+    "effective_from"   TIMESTAMP WITH TIME ZONE NOT NULL,
+    "created_at"       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    "applied_at"       TIMESTAMP WITH TIME ZONE NULL
+);
+
+CREATE INDEX "schedules_url_id_idx" ON "schedules" ("url_id");
+CREATE INDEX "schedules_pending_idx" ON "schedules" ("effective_from") WHERE "applied_at" IS NULL;
+CREATE INDEX "schedules_applied_at_idx" ON "schedules" ("applied_at");
+
+CREATE SEQUENCE "changes_id_seq";
+
+CREATE TABLE "changes" (
+    "id"           INTEGER PRIMARY KEY DEFAULT NEXTVAL('changes_id_seq'),
+    "url_id"       INTEGER NOT NULL REFERENCES "urls" ("id") ON DELETE CASCADE,
+    "old_url"      TEXT NULL,
+    "new_url"      TEXT NOT NULL,
+    "changed_at"   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    "actor"        VARCHAR(100) NOT NULL
+);
+
+CREATE INDEX "changes_url_id_changed_at_idx" ON "changes" ("url_id", "changed_at");
+
+CREATE SEQUENCE "audit_id_seq";
+
+CREATE TABLE "audit" (
+    "id"           BIGINT PRIMARY KEY DEFAULT NEXTVAL('audit_id_seq'),
+    "subject"      VARCHAR(20) NOT NULL,
+    "action"       VARCHAR(20) NOT NULL,
+    "url_id"       INTEGER NULL,
+    "actor"        VARCHAR(100) NOT NULL,
+    "ip"           VARCHAR(45) NOT NULL,
+    "user_agent"   TEXT NOT NULL,
+    "request_id"   VARCHAR(64) NOT NULL,
+    "before"       TEXT NULL,
+    "after"        TEXT NULL,
+    "created_at"   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    "prev_hash"    VARCHAR(64) UNIQUE NOT NULL,
+    "hash"         VARCHAR(64) UNIQUE NOT NULL
+);
+
+CREATE INDEX "audit_url_id_idx" ON "audit" ("url_id");
+
+CREATE FUNCTION "audit_append_only"() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit entries cannot be modified nor deleted';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER "audit_append_only" BEFORE UPDATE OR DELETE OR TRUNCATE ON "audit"
+    FOR EACH STATEMENT EXECUTE FUNCTION "audit_append_only"();
+
+CREATE UNLOGGED TABLE "rate_limits" (
+    "key"          VARCHAR(100) PRIMARY KEY,
+    "tokens"       DOUBLE PRECISION NOT NULL,
+    "allowed"      BOOLEAN NOT NULL,
+    "updated_at"   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX "rate_limits_updated_at_idx" ON "rate_limits" ("updated_at");
+
+CREATE SEQUENCE "webhooks_id_seq";
+
+CREATE TABLE "webhooks" (
+    "id"           INTEGER PRIMARY KEY DEFAULT NEXTVAL('webhooks_id_seq'),
+    "url"          VARCHAR(2048) NOT NULL,
+    "secret"       VARCHAR(128) NOT NULL,
+    "events"       TEXT[] NOT NULL,
+    "created_at"   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE SEQUENCE "deliveries_id_seq";
+
+CREATE TABLE "deliveries" (
+    "id"                BIGINT PRIMARY KEY DEFAULT NEXTVAL('deliveries_id_seq'),
+    "webhook_id"        INTEGER NOT NULL REFERENCES "webhooks" ("id") ON DELETE CASCADE,
+    "event"             VARCHAR(20) NOT NULL,
+    "payload"           TEXT NOT NULL,
+    "status"            VARCHAR(20) NOT NULL DEFAULT 'pending',
+    "attempts"          INTEGER NOT NULL DEFAULT 0,
+    "next_attempt_at"   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    "created_at"        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    "finished_at"       TIMESTAMP WITH TIME ZONE NULL
+);
+
+CREATE INDEX "deliveries_webhook_id_idx" ON "deliveries" ("webhook_id", "id");
+CREATE INDEX "deliveries_pending_idx" ON "deliveries" ("next_attempt_at") WHERE "status" = 'pending';
+CREATE INDEX "deliveries_finished_at_idx" ON "deliveries" ("finished_at");
+
+CREATE SEQUENCE "delivery_attempts_id_seq";
+
+CREATE TABLE "delivery_attempts" (
+    "id"             BIGINT PRIMARY KEY DEFAULT NEXTVAL('delivery_attempts_id_seq'),
+    "delivery_id"    BIGINT NOT NULL REFERENCES "deliveries" ("id") ON DELETE CASCADE,
+    "attempted_at"   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    "code"           INTEGER NULL,
+    "error"          TEXT NULL,
+    "duration"       INTEGER NOT NULL
+);
+
+CREATE INDEX "delivery_attempts_delivery_id_idx" ON "delivery_attempts" ("delivery_id");